@@ -30,6 +30,7 @@ func main() {
 }
 
 func newLSPCommand() *cobra.Command {
+	var opts yaml.Options
 	cmd := &cobra.Command{
 		Use:   "pulumi-lsp",
 		Short: "A LSP for Pulumi YAML",
@@ -44,7 +45,7 @@ func newLSPCommand() *cobra.Command {
 					panic(err)
 				}
 			}()
-			server := lsp.NewServer(yaml.Methods(host), &stdio{false})
+			server := lsp.NewServer(yaml.Methods(host, opts), &stdio{false})
 			err = server.Run(context.Background())
 			if err != nil {
 				panic(err)
@@ -52,6 +53,10 @@ func newLSPCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringSliceVar(&opts.SchemaDirectories, "schema-dir", nil,
+		"A directory of local schema files (`<pkg>.json`, `<pkg>-<version>.json` or `<pkg>/schema.json`), "+
+			"searched before loading schemas from plugins. May be repeated.")
+
 	cmd.AddCommand(newVersionCmd())
 	return cmd
 }
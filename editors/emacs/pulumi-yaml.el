@@ -70,6 +70,7 @@ Note: automatic downloads are only supported when using `lsp-mode'."
 (add-to-list 'auto-mode-alist (cons (regexp-quote "Pulumi.yaml") 'pulumi-yaml-mode))
 (add-to-list 'auto-mode-alist (cons (regexp-quote "Pulumi.yml") 'pulumi-yaml-mode))
 (add-to-list 'auto-mode-alist (cons (regexp-quote "Main.yaml") 'pulumi-yaml-mode))
+(add-to-list 'auto-mode-alist (cons "Pulumi\\.[^/]+\\.ya?ml\\'" 'pulumi-yaml-mode))
 
 (with-eval-after-load 'lsp-mode
   (require 'lsp-mode)
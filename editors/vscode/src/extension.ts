@@ -17,7 +17,13 @@ class PulumiLSPClient extends lc.LanguageClient {
       documentSelector: [
         { pattern: "**/Pulumi.yaml" },
         { pattern: "**/Main.yaml" },
+        { pattern: "**/Pulumi.*.yaml" },
       ],
+      synchronize: {
+        // Send the "pulumi-lsp" settings to the server, so it can pick up
+        // changes to `schemaDirectories`.
+        configurationSection: "pulumi-lsp",
+      },
     };
 
     super("pulumi-lsp", "Pulumi LSP", serverOptions, clientOptions);
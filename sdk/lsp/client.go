@@ -14,6 +14,31 @@ import (
 type Client struct {
 	inner protocol.Client
 	ctx   context.Context
+
+	// If the client supports server initiated work done progress.
+	workDoneProgress bool
+}
+
+type clientContextKey struct{}
+
+// withClient returns a context that carries `c`, retrievable with
+// ClientFromContext.
+func withClient(ctx context.Context, c Client) context.Context {
+	c.ctx = nil
+	return context.WithValue(ctx, clientContextKey{}, c)
+}
+
+// ClientFromContext retrieves the Client that `ctx` was derived from. The
+// returned Client is bound to `ctx`.
+//
+// This allows code that is only passed a context.Context, such as a
+// schema.ReferenceLoader, to communicate with the client.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientContextKey{}).(Client)
+	if ok {
+		c.ctx = ctx
+	}
+	return c, ok
 }
 
 func (c *Client) Progress(params *protocol.ProgressParams) error {
@@ -90,6 +115,10 @@ func (c *Client) LogDebugf(msg string, args ...interface{}) error {
 }
 
 // Retrieve the Context of method that Client was passed with.
+//
+// Each request is handled with its own context, which is canceled when the
+// client sends `$/cancelRequest` for that request. Handlers should pass this
+// context to any potentially slow operation, so they can return early.
 func (c *Client) Context() context.Context {
 	return c.ctx
 }
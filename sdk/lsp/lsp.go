@@ -8,7 +8,10 @@ package lsp
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
@@ -24,6 +27,10 @@ type Server struct {
 	isInitialized bool
 	client        protocol.Client
 
+	// If the client accepts work done progress notifications initiated by the
+	// server. This is set during initialization.
+	workDoneProgress bool
+
 	// The logger used by the server.
 	Logger *zap.SugaredLogger
 }
@@ -63,9 +70,83 @@ func (s *Server) run(ctx context.Context) context.Context {
 	s.methods.server = s
 	s.methods.closer = closer
 
-	stream := jsonrpc2.NewStream(s.conn)
-	go func() {
-		ctx, _, s.client = protocol.NewServer(ctx, s.methods.serve(), stream, s.Logger.Desugar())
-	}()
+	// This mirrors protocol.NewServer, but allows us to control how canceled
+	// requests are replied to.
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(s.conn))
+	s.client = protocol.ClientDispatcher(conn, s.Logger.Desugar().Named("client"))
+	ctx = protocol.WithClient(ctx, s.client)
+	go conn.Go(ctx, cancelHandler(jsonrpc2.AsyncHandler(jsonrpc2.ReplyHandler(
+		cancelReplyHandler(protocol.ServerHandler(s.methods.serve(), jsonrpc2.MethodNotFoundHandler)),
+	))))
 	return ctx
 }
+
+// cancelReplyHandler ensures that a request canceled by the client (via
+// `$/cancelRequest`) is always answered with `RequestCancelled`.
+//
+// Each request is given its own context, which is canceled when the client
+// cancels the request. A handler that observes the cancellation usually returns
+// an error such as `context.Canceled`, which would otherwise be reported back to
+// the client as a generic failure.
+func cancelReplyHandler(handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		return handler(ctx, func(replyCtx context.Context, result interface{}, err error) error {
+			if _, isCall := req.(*jsonrpc2.Call); isCall && ctx.Err() != nil {
+				return reply(replyCtx, nil, protocol.ErrRequestCancelled)
+			}
+			return reply(replyCtx, result, err)
+		}, req)
+	}
+}
+
+// cancelHandler handles `$/cancelRequest` by canceling the context of the
+// request it names.
+//
+// It replaces protocol.CancelHandler, which only understands IDs that decode as
+// int32 or string. Request IDs decode as float64, so numeric IDs, which most
+// clients send, would never be canceled.
+func cancelHandler(handler jsonrpc2.Handler) jsonrpc2.Handler {
+	handler, canceller := jsonrpc2.CancelHandler(handler)
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() != protocol.MethodCancelRequest {
+			return handler(ctx, func(ctx context.Context, result interface{}, err error) error {
+				// The reply must be sent even if the request was canceled.
+				return reply(context.WithoutCancel(ctx), result, err)
+			}, req)
+		}
+
+		var params protocol.CancelParams
+		if err := json.Unmarshal(req.Params(), &params); err != nil {
+			return reply(ctx, nil, fmt.Errorf("%s: %w", jsonrpc2.ErrParse, err))
+		}
+		id, ok := requestID(params.ID)
+		if !ok {
+			return reply(ctx, nil, fmt.Errorf("%s: request ID %v malformed", jsonrpc2.ErrParse, params.ID))
+		}
+		canceller(id)
+		return reply(ctx, nil, nil)
+	}
+}
+
+// requestID converts a decoded JSON request ID into a jsonrpc2.ID.
+func requestID(id interface{}) (jsonrpc2.ID, bool) {
+	switch id := id.(type) {
+	case string:
+		return jsonrpc2.NewStringID(id), true
+	case int32:
+		return jsonrpc2.NewNumberID(id), true
+	case float64:
+		if id != math.Trunc(id) || id < math.MinInt32 || id > math.MaxInt32 {
+			return jsonrpc2.ID{}, false
+		}
+		return jsonrpc2.NewNumberID(int32(id)), true
+	case json.Number:
+		n, err := id.Int64()
+		if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+			return jsonrpc2.ID{}, false
+		}
+		return jsonrpc2.NewNumberID(int32(n)), true
+	default:
+		return jsonrpc2.ID{}, false
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+func TestCancelReplyHandler(t *testing.T) {
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(1), protocol.MethodTextDocumentCompletion, nil)
+	require.NoError(t, err)
+
+	handler := cancelReplyHandler(func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		<-ctx.Done()
+		return reply(ctx, nil, ctx.Err())
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var replied error
+	err = handler(ctx, func(_ context.Context, _ interface{}, err error) error {
+		replied = err
+		return nil
+	}, call)
+	require.NoError(t, err)
+	assert.True(t, errors.Is(replied, protocol.ErrRequestCancelled))
+}
+
+func TestCancelReplyHandlerPassesErrors(t *testing.T) {
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(1), protocol.MethodTextDocumentHover, nil)
+	require.NoError(t, err)
+	expected := errors.New("expected")
+
+	handler := cancelReplyHandler(func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		return reply(ctx, nil, expected)
+	})
+
+	var replied error
+	err = handler(context.Background(), func(_ context.Context, _ interface{}, err error) error {
+		replied = err
+		return nil
+	}, call)
+	require.NoError(t, err)
+	assert.Equal(t, expected, replied)
+}
+
+func TestCancelRequestWithNumericID(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	methods := &Methods{
+		HoverFunc: func(client Client, params *protocol.HoverParams) (*protocol.Hover, error) {
+			close(started)
+			<-client.Context().Done()
+			close(canceled)
+			return nil, client.Context().Err()
+		},
+	}
+	serverConn, clientConn := net.Pipe()
+	server := NewServer(methods, serverConn)
+	server.Logger = zap.NewNop().Sugar()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server.run(ctx)
+
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(clientConn))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	defer conn.Close()
+
+	replied := make(chan error)
+	go func() {
+		var result protocol.Hover
+		_, err := conn.Call(ctx, protocol.MethodTextDocumentHover, &protocol.HoverParams{}, &result)
+		replied <- err
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hover request was never handled")
+	}
+	// The ID of the first call. Encoded as a JSON number, it decodes as a
+	// float64.
+	require.NoError(t, conn.Notify(ctx, protocol.MethodCancelRequest, map[string]interface{}{"id": 1}))
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hover request was not canceled")
+	}
+	select {
+	case err := <-replied:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), protocol.ErrRequestCancelled.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hover request was never answered")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		id       interface{}
+		expected jsonrpc2.ID
+		ok       bool
+	}{
+		{float64(3), jsonrpc2.NewNumberID(3), true},
+		{json.Number("4"), jsonrpc2.NewNumberID(4), true},
+		{int32(5), jsonrpc2.NewNumberID(5), true},
+		{"six", jsonrpc2.NewStringID("six"), true},
+		{1.5, jsonrpc2.ID{}, false},
+		{float64(1 << 40), jsonrpc2.ID{}, false},
+		{nil, jsonrpc2.ID{}, false},
+	} {
+		id, ok := requestID(tc.id)
+		assert.Equal(t, tc.ok, ok, "%v", tc.id)
+		assert.Equal(t, tc.expected, id, "%v", tc.id)
+	}
+}
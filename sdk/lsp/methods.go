@@ -108,10 +108,17 @@ func (m Methods) DefaultInitializer(name, version string) *Methods {
 				CodeActionKinds: []protocol.CodeActionKind{
 					// TODO: how do we let the user communicate this.
 					protocol.RefactorRewrite,
+					protocol.QuickFix,
 				},
 				ResolveProvider: false,
 			}
 		}
+		var documentLink *protocol.DocumentLinkOptions
+		if m.DocumentLinkFunc != nil {
+			documentLink = &protocol.DocumentLinkOptions{
+				ResolveProvider: m.DocumentLinkResolveFunc != nil,
+			}
+		}
 		return &protocol.InitializeResult{
 			Capabilities: protocol.ServerCapabilities{
 				TextDocumentSync: &protocol.TextDocumentSyncOptions{
@@ -127,7 +134,7 @@ func (m Methods) DefaultInitializer(name, version string) *Methods {
 				HoverProvider:      hover,
 				// SignatureHelpProvider:            &protocol.SignatureHelpOptions{},
 				// DeclarationProvider:              nil,
-				// DefinitionProvider:               nil,
+				DefinitionProvider: m.DefinitionFunc != nil,
 				// TypeDefinitionProvider:           nil,
 				// ImplementationProvider:           nil,
 				// ReferencesProvider:               nil,
@@ -135,7 +142,7 @@ func (m Methods) DefaultInitializer(name, version string) *Methods {
 				// DocumentSymbolProvider:           nil,
 				CodeActionProvider: codeAction,
 				// CodeLensProvider:                 &protocol.CodeLensOptions{},
-				// DocumentLinkProvider:             &protocol.DocumentLinkOptions{},
+				DocumentLinkProvider: documentLink,
 				// ColorProvider:                    nil,
 				// WorkspaceSymbolProvider:          nil,
 				// DocumentFormattingProvider:       nil,
@@ -162,10 +169,12 @@ func (m Methods) DefaultInitializer(name, version string) *Methods {
 }
 
 func (m *methods) client(ctx context.Context) Client {
-	return Client{
-		inner: m.server.client,
-		ctx:   ctx,
+	c := Client{
+		inner:            m.server.client,
+		workDoneProgress: m.server.workDoneProgress,
 	}
+	c.ctx = withClient(ctx, c)
+	return c
 }
 
 func (m *Methods) serve() *methods {
@@ -183,6 +192,9 @@ func (m *methods) warnUninitialized(name string) {
 }
 
 func (m *methods) Initialize(ctx context.Context, params *protocol.InitializeParams) (result *protocol.InitializeResult, err error) {
+	if w := params.Capabilities.Window; w != nil {
+		m.server.workDoneProgress = w.WorkDoneProgress
+	}
 	if m.InitializeFunc != nil {
 		result, err = m.InitializeFunc(m.client(ctx), params)
 	} else {
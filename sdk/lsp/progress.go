@@ -0,0 +1,98 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.lsp.dev/protocol"
+)
+
+// The source of unique progress tokens.
+var progressTokens atomic.Int32
+
+// Progress reports the progress of a long running operation to the client. It
+// is created by Client.BeginProgress and should always be finished with End.
+//
+// If the client does not support work done progress, reporting is a no-op. A nil
+// *Progress is valid, and never reports anything.
+type Progress struct {
+	client Client
+	// The token identifying the progress. A nil token indicates that progress
+	// is not being reported.
+	token *protocol.ProgressToken
+}
+
+// BeginProgress starts reporting progress on a new operation called `title`.
+//
+// Progress is reported even after the context of `c` is canceled, so that the
+// operation can always be ended.
+func (c *Client) BeginProgress(title, message string) (*Progress, error) {
+	client := *c
+	client.ctx = context.WithoutCancel(c.ctx)
+	p := &Progress{client: client}
+	if !c.workDoneProgress {
+		return p, nil
+	}
+	token := protocol.NewProgressToken(fmt.Sprintf("pulumi-lsp/%d", progressTokens.Add(1)))
+	err := p.client.WorkDoneProgressCreate(&protocol.WorkDoneProgressCreateParams{Token: *token})
+	if err != nil {
+		return p, err
+	}
+	p.token = token
+	return p, p.send(&protocol.WorkDoneProgressBegin{
+		Kind:    protocol.WorkDoneProgressKindBegin,
+		Title:   title,
+		Message: message,
+	})
+}
+
+type progressContextKey struct{}
+
+// WithProgress returns a context that carries `p`, retrievable with
+// ProgressFromContext.
+//
+// This lets work done on behalf of an operation that already reports progress
+// avoid reporting progress of its own.
+func WithProgress(ctx context.Context, p *Progress) context.Context {
+	return context.WithValue(ctx, progressContextKey{}, p)
+}
+
+// ProgressFromContext retrieves the Progress attached to `ctx` by WithProgress.
+func ProgressFromContext(ctx context.Context) (*Progress, bool) {
+	p, ok := ctx.Value(progressContextKey{}).(*Progress)
+	return p, ok
+}
+
+// Report an update on the operation. `percentage` should be between 0 and 100.
+func (p *Progress) Report(message string, percentage uint32) error {
+	return p.send(&protocol.WorkDoneProgressReport{
+		Kind:       protocol.WorkDoneProgressKindReport,
+		Message:    message,
+		Percentage: percentage,
+	})
+}
+
+// End the operation. No more progress should be reported after End is called.
+func (p *Progress) End(message string) error {
+	err := p.send(&protocol.WorkDoneProgressEnd{
+		Kind:    protocol.WorkDoneProgressKindEnd,
+		Message: message,
+	})
+	if p != nil {
+		p.token = nil
+	}
+	return err
+}
+
+func (p *Progress) send(value interface{}) error {
+	if p == nil || p.token == nil {
+		return nil
+	}
+	return p.client.Progress(&protocol.ProgressParams{
+		Token: *p.token,
+		Value: value,
+	})
+}
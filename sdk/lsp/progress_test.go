@@ -0,0 +1,81 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+)
+
+// A protocol.Client that records progress notifications. Calling any other
+// method panics.
+type progressRecorder struct {
+	protocol.Client
+
+	created []protocol.ProgressToken
+	values  []interface{}
+}
+
+func (r *progressRecorder) WorkDoneProgressCreate(_ context.Context, params *protocol.WorkDoneProgressCreateParams) error {
+	r.created = append(r.created, params.Token)
+	return nil
+}
+
+func (r *progressRecorder) Progress(_ context.Context, params *protocol.ProgressParams) error {
+	r.values = append(r.values, params.Value)
+	return nil
+}
+
+func TestProgress(t *testing.T) {
+	recorder := &progressRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := Client{inner: recorder, workDoneProgress: true}
+	c.ctx = withClient(ctx, c)
+
+	client, ok := ClientFromContext(c.Context())
+	require.True(t, ok)
+	p, err := client.BeginProgress("title", "starting")
+	require.NoError(t, err)
+	// Progress should be reported even after the request is canceled.
+	cancel()
+	require.NoError(t, p.Report("working", 50))
+	require.NoError(t, p.End("done"))
+	require.NoError(t, p.Report("ignored", 100))
+
+	assert.Len(t, recorder.created, 1)
+	assert.Equal(t, []interface{}{
+		&protocol.WorkDoneProgressBegin{Kind: protocol.WorkDoneProgressKindBegin, Title: "title", Message: "starting"},
+		&protocol.WorkDoneProgressReport{Kind: protocol.WorkDoneProgressKindReport, Message: "working", Percentage: 50},
+		&protocol.WorkDoneProgressEnd{Kind: protocol.WorkDoneProgressKindEnd, Message: "done"},
+	}, recorder.values)
+}
+
+func TestProgressUnsupported(t *testing.T) {
+	recorder := &progressRecorder{}
+	c := Client{inner: recorder, ctx: context.Background()}
+
+	p, err := c.BeginProgress("title", "starting")
+	require.NoError(t, err)
+	require.NoError(t, p.End("done"))
+	assert.Empty(t, recorder.created)
+	assert.Empty(t, recorder.values)
+
+	var nilProgress *Progress
+	assert.NoError(t, nilProgress.End("done"))
+}
+
+func TestProgressFromContext(t *testing.T) {
+	_, ok := ProgressFromContext(context.Background())
+	assert.False(t, ok)
+
+	c := Client{inner: &progressRecorder{}, ctx: context.Background()}
+	p, err := c.BeginProgress("title", "starting")
+	require.NoError(t, err)
+	found, ok := ProgressFromContext(WithProgress(context.Background(), p))
+	assert.True(t, ok)
+	assert.Same(t, p, found)
+}
@@ -39,6 +39,15 @@ func (s *Step[T]) TryGetResult() (T, bool) {
 // Block on retrieving the computed result. If the computation is canceled,
 // Zero[T](), false is returned.
 func (s *Step[T]) GetResult() (T, bool) {
+	return s.GetResultContext(context.Background())
+}
+
+// Block on retrieving the computed result, giving up if either the computation
+// or `ctx` is canceled. In either case, Zero[T](), false is returned.
+//
+// This is used to wait on a Step from within a request that can itself be
+// canceled.
+func (s *Step[T]) GetResultContext(ctx context.Context) (T, bool) {
 	if s == nil {
 		return Zero[T](), false
 	}
@@ -47,6 +56,8 @@ func (s *Step[T]) GetResult() (T, bool) {
 		return s.data, true
 	case <-s.ctx.Done():
 		return Zero[T](), false
+	case <-ctx.Done():
+		return Zero[T](), false
 	}
 }
 
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/blang/semver"
 	"github.com/hashicorp/hcl/v2"
 	"go.lsp.dev/protocol"
 
@@ -32,6 +33,13 @@ type documentAnalysisPipeline struct {
 
 	// Then the program is analyzed
 	bound *step.Step[util.Tuple[*bind.Decl, *hcl.Diagnostic]]
+
+	// The objects of the bound program, by position.
+	index *step.Step[*objectIndex]
+
+	// The parsed template was recovered from a document that doesn't parse. It
+	// is only written before `parsed` finishes.
+	recovered bool
 }
 
 func inferParseErrorLine(err string) (int, bool) {
@@ -57,6 +65,13 @@ func (d *documentAnalysisPipeline) parse(text lsp.Document) {
 		} else if d.parsed == nil {
 			parseDiags = append(parseDiags, d.promoteError("Parse error", fmt.Errorf("no template returned")))
 		}
+		if parsed == nil && err == nil {
+			// Documents often don't parse while they are being edited. The
+			// rest of the document is still analyzed, so that hover and
+			// completion keep working.
+			parsed = recoverTemplate(text.URI().Filename(), text.String())
+			d.recovered = parsed != nil
+		}
 
 		for _, d := range parseDiags {
 			if line, ok := inferParseErrorLine(d.Summary); ok {
@@ -90,9 +105,25 @@ func (d *documentAnalysisPipeline) bind(t util.Tuple[*ast.TemplateDecl, hcl.Diag
 	return util.Tuple[*bind.Decl, *hcl.Diagnostic]{A: bound, B: hclErr}, true
 }
 
+// Index the objects of the bound document, so that hover and completion can
+// find the object at a position quickly.
+func (d *documentAnalysisPipeline) buildIndex(t util.Tuple[*bind.Decl, *hcl.Diagnostic]) (*objectIndex, bool) {
+	parsed, ok := d.parsed.TryGetResult()
+	if !ok || parsed.A == nil || t.A == nil {
+		return nil, true
+	}
+	return buildObjectIndex(parsed.A, t.A), true
+}
+
 // Creates a new asynchronous analysis pipeline, returning a handle to the
 // process. To avoid a memory leak, ${RESULT}.cancel must be called.
-func NewDocumentAnalysisPipeline(c lsp.Client, text lsp.Document, loader schema.ReferenceLoader) *documentAnalysisPipeline {
+//
+// If `installed` is not nil, it lists the installed plugin versions that pinned
+// package versions are checked against.
+func NewDocumentAnalysisPipeline(
+	c lsp.Client, text lsp.Document, loader schema.ReferenceLoader,
+	installed func() (map[string][]semver.Version, error),
+) *documentAnalysisPipeline {
 	ctx, cancel := context.WithCancel(c.Context())
 	d := &documentAnalysisPipeline{
 		ctx:    ctx,
@@ -115,11 +146,21 @@ func NewDocumentAnalysisPipeline(c lsp.Client, text lsp.Document, loader schema.
 			err := d.sendDiags(c, text.URI())
 			contract.IgnoreError(err)
 		})
+		d.index = step.Then(d.bound, d.buildIndex)
 
 		schematize := step.Then(d.bound, func(t util.Tuple[*bind.Decl, *hcl.Diagnostic]) (struct{}, bool) {
 			if t.A != nil {
-				t.A.LoadSchema(loader)
-				return struct{}{}, true
+				if installed != nil {
+					if versions, err := installed(); err == nil {
+						t.A.CheckInstalledVersions(versions)
+					} else {
+						c.LogInfof("Could not list installed plugins: %s", err.Error())
+					}
+				}
+				t.A.LoadSchema(d.ctx, loader)
+				// If the analysis was canceled, the schema is incomplete and
+				// should not be reported.
+				return struct{}{}, d.ctx.Err() == nil
 			}
 			return struct{}{}, false
 		})
@@ -143,7 +184,8 @@ func (d *documentAnalysisPipeline) diags() hcl.Diagnostics {
 		if bound.B != nil {
 			arr = append(arr, bound.B)
 		}
-		if bound.A != nil {
+		// Only the parse errors of a recovered document are reported.
+		if bound.A != nil && !d.recovered {
 			arr = append(arr, bound.A.Diags()...)
 		}
 	}
@@ -152,20 +194,17 @@ func (d *documentAnalysisPipeline) diags() hcl.Diagnostics {
 
 // Actually send the report request to the lsp server
 func (d *documentAnalysisPipeline) sendDiags(c lsp.Client, uri protocol.DocumentURI) error {
+	return publishDiags(c, uri, d.diags())
+}
+
+// Publish `diags` as the diagnostics of the document at `uri`.
+func publishDiags(c lsp.Client, uri protocol.DocumentURI, diags hcl.Diagnostics) error {
 	lspDiags := []protocol.Diagnostic{}
-	for _, diag := range d.diags() {
+	for _, diag := range diags {
 		if diag == nil {
 			continue
 		}
-		diagnostic := protocol.Diagnostic{
-			Severity: convertSeverity(diag.Severity),
-			Source:   "pulumi-yaml",
-			Message:  diag.Summary + "\n" + diag.Detail,
-		}
-		if diag.Subject != nil {
-			diagnostic.Range = convertRange(diag.Subject)
-		}
-
+		diagnostic := convertDiagnostic(diag, uri)
 		lspDiags = append(lspDiags, diagnostic)
 		c.LogDebugf("Preparing diagnostic %v", diagnostic)
 	}
@@ -179,6 +218,40 @@ func (d *documentAnalysisPipeline) sendDiags(c lsp.Client, uri protocol.Document
 	})
 }
 
+// Convert an hcl diagnostic into an LSP diagnostic for the document at `uri`.
+func convertDiagnostic(diag *hcl.Diagnostic, uri protocol.DocumentURI) protocol.Diagnostic {
+	diagnostic := protocol.Diagnostic{
+		Severity: convertSeverity(diag.Severity),
+		Source:   "pulumi-yaml",
+		Message:  diag.Summary + "\n" + diag.Detail,
+	}
+	if diag.Subject != nil {
+		diagnostic.Range = convertRange(diag.Subject)
+	}
+	if extra, ok := bind.Extra(diag); ok {
+		for _, related := range extra.Related {
+			if related.Range == nil {
+				continue
+			}
+			diagnostic.RelatedInformation = append(diagnostic.RelatedInformation,
+				protocol.DiagnosticRelatedInformation{
+					Location: protocol.Location{
+						URI:   rangeURI(related.Range, uri),
+						Range: convertRange(related.Range),
+					},
+					Message: related.Message,
+				})
+		}
+		if extra.Unnecessary {
+			diagnostic.Tags = append(diagnostic.Tags, protocol.DiagnosticTagUnnecessary)
+		}
+		if extra.Deprecated {
+			diagnostic.Tags = append(diagnostic.Tags, protocol.DiagnosticTagDeprecated)
+		}
+	}
+	return diagnostic
+}
+
 func (d *documentAnalysisPipeline) promoteError(msg string, err error) *hcl.Diagnostic {
 	return &hcl.Diagnostic{
 		Severity: hcl.DiagError,
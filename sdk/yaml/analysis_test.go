@@ -0,0 +1,54 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+func TestConvertDiagnostic(t *testing.T) {
+	const uri = "file:///Pulumi.yaml"
+	rng := func(line int) *hcl.Range {
+		return &hcl.Range{
+			Start: hcl.Pos{Line: line, Column: 3},
+			End:   hcl.Pos{Line: line, Column: 6},
+		}
+	}
+
+	diag := convertDiagnostic(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Duplicate Binding",
+		Subject:  rng(9),
+		Extra: bind.DiagnosticExtra{Related: []bind.RelatedInformation{
+			{Message: "'dup' is first bound here", Range: rng(4)},
+			{Message: "Ranges that are not known are skipped"},
+		}},
+	}, uri)
+	assert.Equal(t, []protocol.DiagnosticRelatedInformation{{
+		Location: protocol.Location{URI: uri, Range: convertRange(rng(4))},
+		Message:  "'dup' is first bound here",
+	}}, diag.RelatedInformation)
+	assert.Empty(t, diag.Tags)
+
+	diag = convertDiagnostic(&hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  "Variable 'unused' is unused",
+		Subject:  rng(3),
+		Extra:    bind.DiagnosticExtra{Unnecessary: true},
+	}, uri)
+	assert.Equal(t, []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary}, diag.Tags)
+
+	diag = convertDiagnostic(&hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  "'test:index:Old' is depreciated",
+		Subject:  rng(12),
+		Extra:    bind.DiagnosticExtra{Deprecated: true},
+	}, uri)
+	assert.Equal(t, []protocol.DiagnosticTag{protocol.DiagnosticTagDeprecated}, diag.Tags)
+}
@@ -6,17 +6,25 @@
 // query.go contains logic to get information out of a `Decl`.
 // schema.go handles loading appropriate schemas and binding them to an existing `Decl`.
 // diags.go contains the diagnostic error messages used.
+// graph.go checks the dependencies between definitions.
+// config.go handles the types of configuration entries.
+// options.go checks the values of resource options.
+// files.go checks the paths given to file builtins.
+// versions.go checks the package versions pinned by the template.
+// types.go infers the types of expressions.
+// secrets.go checks that secrets are not exposed in plaintext.
 package bind
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/hcl/v2"
 
 	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
 	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
-	"github.com/pulumi/pulumi/pkg/v3/codegen"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 
 	"github.com/pulumi/pulumi-lsp/sdk/util"
@@ -34,11 +42,28 @@ type Decl struct {
 
 	// The set of all invokes.
 	invokes map[*Invoke]struct{}
+	// Each invoke, by the expression that defines it.
+	invokeExprs map[*ast.InvokeExpr]*Invoke
 
 	diags hcl.Diagnostics
 
+	// The names referenced by each variable and resource definition.
+	dependencies map[string][]dependency
+	// The name of the definition currently being bound, if any.
+	binding string
+	// The definitions that are part of a dependency cycle.
+	cyclic map[string]bool
+
+	// The paths passed to file builtins.
+	filePaths []FilePath
+
 	loadedPackages map[pkgKey]pkgCache
 
+	// The inferred type of each expression, see types.go.
+	exprTypes    map[ast.Expr]schema.Type
+	pendingTypes map[ast.Expr]schema.Type
+	typesLock    *sync.Mutex
+
 	lock *sync.RWMutex
 }
 
@@ -47,6 +72,13 @@ type pkgKey struct {
 	version string
 }
 
+func (k pkgKey) String() string {
+	if k.version == "" {
+		return k.name
+	}
+	return k.name + "@" + k.version
+}
+
 // A value that a reference can bind to. This includes the variables, config and
 // resources section of the yaml template.
 type Variable struct {
@@ -109,7 +141,7 @@ type PropertyAccessorList []PropertyAccessor
 // has 1 element since it includes the root.
 func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hcl.Diagnostic) {
 	types := []schema.Type{root}
-	handleProperties := func(tag string, props []*schema.Property, parent schema.Type, rnge *hcl.Range) (*schema.Property, *hcl.Diagnostic) {
+	handleProperties := func(tag string, props []*schema.Property, parent string, rnge *hcl.Range) (*schema.Property, *hcl.Diagnostic) {
 		existing := map[string]struct{}{}
 		for _, p := range props {
 			if p.Name == tag {
@@ -117,7 +149,7 @@ func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hc
 			}
 			existing[p.Name] = struct{}{}
 		}
-		return nil, propertyDoesNotExistDiag(tag, parent.String(), util.MapKeys(existing), rnge)
+		return nil, propertyDoesNotExistDiag(tag, parent, util.MapKeys(existing), rnge)
 	}
 
 	getStringTag := func(p ast.PropertyAccessor) string {
@@ -144,7 +176,7 @@ func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hc
 			types = append(types, t)
 			root = t
 		}
-		switch typ := codegen.UnwrapType(root).(type) {
+		switch typ := UnwrapType(root).(type) {
 		case *schema.ArrayType:
 			if s, ok := prop.PropertyAccessor.(*ast.PropertySubscript); ok {
 				if _, ok := s.Index.(int); ok {
@@ -180,7 +212,7 @@ func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hc
 				return exit(nil)
 			}
 
-			prop, diag := handleProperties(tag, util.ResourceProperties(r), typ, prop.rnge)
+			prop, diag := handleProperties(tag, util.ResourceProperties(r), typ.String(), prop.rnge)
 			if diag != nil {
 				return exit(diag)
 			}
@@ -191,7 +223,13 @@ func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hc
 			if tag == "" {
 				return exit(noPropertyIndexDiag(typ.String(), prop.rnge))
 			}
-			prop, diag := handleProperties(tag, typ.Properties, typ, prop.rnge)
+			// Object literals have no token, so their shape is displayed
+			// instead.
+			parent := typ.String()
+			if typ.Token == "" {
+				parent = diags.DisplayType(typ)
+			}
+			prop, diag := handleProperties(tag, typ.Properties, parent, prop.rnge)
 			if diag != nil {
 				return exit(diag)
 			}
@@ -201,6 +239,44 @@ func (l PropertyAccessorList) TypeFromRoot(root schema.Type) ([]schema.Type, *hc
 	return exit(nil)
 }
 
+// PropertyFromRoot finds the schema property read by the last accessor of `l`,
+// starting from `root`. It fails if the last accessor doesn't name a property of
+// a resource or object.
+func (l PropertyAccessorList) PropertyFromRoot(root schema.Type) (*schema.Property, bool) {
+	if len(l) == 0 {
+		return nil, false
+	}
+	types, diag := l.TypeFromRoot(root)
+	if diag != nil || len(types) != len(l)+1 {
+		return nil, false
+	}
+	var props []*schema.Property
+	switch parent := UnwrapType(types[len(types)-2]).(type) {
+	case *schema.ResourceType:
+		if parent.Resource == nil {
+			return nil, false
+		}
+		props = util.ResourceProperties(parent.Resource)
+	case *schema.ObjectType:
+		props = parent.Properties
+	default:
+		return nil, false
+	}
+	var tag string
+	switch a := l[len(l)-1].PropertyAccessor.(type) {
+	case *ast.PropertyName:
+		tag = a.Name
+	case *ast.PropertySubscript:
+		tag, _ = a.Index.(string)
+	}
+	for _, p := range props {
+		if p.Name == tag {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
 type PropertyAccessor struct {
 	ast.PropertyAccessor
 
@@ -269,6 +345,9 @@ func (b *Decl) newRefernce(variable string, loc *hcl.Range, accessor []ast.Prope
 	ref.variable = v
 	ref.s = repr
 	v.uses = append(v.uses, ref)
+	if b.binding != "" && variable != "" {
+		b.dependencies[b.binding] = append(b.dependencies[b.binding], dependency{variable, loc})
+	}
 
 }
 
@@ -321,14 +400,7 @@ type ResolvableType interface {
 }
 
 func (c *ConfigMapEntry) ResolveType(*Decl) schema.Type {
-	switch c.Value.Type.Value {
-	case "string":
-		return schema.StringType
-	case "int":
-		return schema.IntType
-	default:
-		return nil
-	}
+	return c.configType()
 }
 
 func (v *VariableMapEntry) ResolveType(d *Decl) schema.Type {
@@ -370,25 +442,32 @@ func NewDecl(decl *ast.TemplateDecl) (*Decl, error) {
 		},
 		outputs:        map[string]ast.PropertyMapEntry{},
 		invokes:        map[*Invoke]struct{}{},
+		invokeExprs:    map[*ast.InvokeExpr]*Invoke{},
 		diags:          hcl.Diagnostics{},
+		dependencies:   map[string][]dependency{},
+		cyclic:         map[string]bool{},
 		loadedPackages: map[pkgKey]pkgCache{},
+		typesLock:      &sync.Mutex{},
 		lock:           &sync.RWMutex{},
 	}
 
-	for _, c := range decl.Configuration.Entries {
-		other, alreadyReferenced := bound.variables[c.Key.Value]
+	for _, c := range append(append([]ast.ConfigMapEntry{}, decl.Configuration.Entries...), decl.Config.Entries...) {
+		name, ok := configVariableName(decl.Name, c.Key.Value)
+		if !ok {
+			continue
+		}
+		entry := &ConfigMapEntry{c}
+		bound.validateConfig(entry)
+		other, alreadyReferenced := bound.variables[name]
 		if alreadyReferenced && other.definition != nil {
 			bound.diags = bound.diags.Append(
-				duplicateSourceDiag(c.Key.Value,
+				duplicateSourceDiag(name,
 					c.Key.Syntax().Syntax().Range(),
 					other.definition.DefinitionRange(),
 				),
 			)
 		} else {
-			bound.variables[c.Key.Value] = &Variable{
-				name:       c.Key.Value,
-				definition: &ConfigMapEntry{c},
-			}
+			bound.define(name, entry)
 		}
 	}
 	for _, v := range decl.Variables.Entries {
@@ -401,11 +480,10 @@ func NewDecl(decl *ast.TemplateDecl) (*Decl, error) {
 				),
 			)
 		} else {
-			bound.variables[v.Key.Value] = &Variable{
-				name:       v.Key.Value,
-				definition: &VariableMapEntry{v},
-			}
+			bound.define(v.Key.Value, &VariableMapEntry{v})
+			bound.binding = v.Key.Value
 			err := bound.bind(v.Value)
+			bound.binding = ""
 			if err != nil {
 				return nil, err
 			}
@@ -428,7 +506,10 @@ func NewDecl(decl *ast.TemplateDecl) (*Decl, error) {
 				),
 			)
 		} else {
-			if err := bound.bindResource(r); err != nil {
+			bound.binding = r.Key.Value
+			err := bound.bindResource(r)
+			bound.binding = ""
+			if err != nil {
 				return nil, err
 			}
 		}
@@ -450,6 +531,11 @@ func NewDecl(decl *ast.TemplateDecl) (*Decl, error) {
 	}
 
 	err := bound.analyzeBindings()
+	bound.checkCycles()
+	bound.checkResourceOptions()
+	bound.checkFilePaths()
+	bound.checkVersionConflicts(decl)
+	bound.inferTypes()
 	return bound, err
 }
 
@@ -521,18 +607,28 @@ func (b *Decl) bind(e ast.Expr) error {
 
 	// Assets and Archives:
 	//
-	// These take only string expressions.
-	// TODO: on a second pass, we could give warnings when they point towards
-	// files that don't exist, provide validation for urls provided, ect.
+	// Paths to local files are checked once binding is done.
 	case *ast.AssetArchiveExpr:
+		keys := util.MapKeys(e.AssetOrArchives)
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := b.bind(e.AssetOrArchives[k]); err != nil {
+				return err
+			}
+		}
 	case *ast.FileArchiveExpr:
+		return b.bindFilePath("fn::fileArchive", e.Source)
 	case *ast.FileAssetExpr:
+		return b.bindFilePath("fn::fileAsset", e.Source)
 	case *ast.RemoteArchiveExpr:
+		return b.bind(e.Source)
 	case *ast.RemoteAssetExpr:
+		return b.bind(e.Source)
 	case *ast.StringAssetExpr:
+		return b.bind(e.Source)
 
 	case *ast.ReadFileExpr:
-		return b.bind(e.Path)
+		return b.bindFilePath("fn::readFile", e.Path)
 	case *ast.SecretExpr:
 		return b.bind(e.Value)
 
@@ -562,6 +658,8 @@ func (b *Decl) bind(e ast.Expr) error {
 		return b.bind(e.Value)
 	case *ast.ToJSONExpr:
 		return b.bind(e.Value)
+	case *ast.FromBase64Expr:
+		return b.bind(e.Value)
 
 	case nil:
 		// The result of some non-fatal parse errors
@@ -572,23 +670,35 @@ func (b *Decl) bind(e ast.Expr) error {
 	return nil
 }
 
+// define binds `name` to `def`. References to `name` that were bound before it
+// was defined keep pointing to it.
+func (d *Decl) define(name string, def Definition) {
+	if v, ok := d.variables[name]; ok {
+		v.definition = def
+		return
+	}
+	d.variables[name] = &Variable{name: name, definition: def}
+}
+
 func (d *Decl) bindInvoke(invoke *ast.InvokeExpr) error {
-	d.invokes[&Invoke{
+	i := &Invoke{
 		token:   invoke.Token.Value,
 		defined: invoke,
 		version: invoke.CallOpts.Version.GetValue(),
-	}] = struct{}{}
+	}
+	d.invokes[i] = struct{}{}
+	d.invokeExprs[invoke] = i
 	return d.bind(invoke.Args())
 }
 
 func (d *Decl) bindResource(r ast.ResourcesMapEntry) error {
 	if r.Value == nil {
-		d.variables[r.Key.Value] = &Variable{definition: &Resource{defined: &r}, name: r.Key.Value}
+		d.define(r.Key.Value, &Resource{defined: &r})
 		d.diags = append(d.diags, missingResourceBodyDiag(r.Key.Value, r.Key.Syntax().Syntax().Range()))
 		return nil
 	}
 	if r.Value.Type == nil {
-		d.variables[r.Key.Value] = &Variable{definition: &Resource{defined: &r}, name: r.Key.Value}
+		d.define(r.Key.Value, &Resource{defined: &r})
 		d.diags = append(d.diags, missingResourceTypeDiag(r.Key.Value, r.Key.Syntax().Syntax().Range()))
 		return nil
 	}
@@ -613,14 +723,17 @@ func (d *Decl) bindResource(r ast.ResourcesMapEntry) error {
 	if err := d.bindResourceOptions(r.Value.Options); err != nil {
 		return err
 	}
-	d.variables[r.Key.Value] = &Variable{definition: &res, name: r.Key.Value}
+	if err := d.bindResourceGet(r); err != nil {
+		return err
+	}
+	d.define(r.Key.Value, &res)
 	return nil
 }
 
 func (b *Decl) bindResourceOptions(opts ast.ResourceOptionsDecl) error {
 	// We only need to bind types that are backed by expressions that could
 	// contain variables.
-	for _, e := range []ast.Expr{opts.DependsOn, opts.Parent, opts.Provider, opts.Providers} {
+	for _, e := range []ast.Expr{opts.DependsOn, opts.Parent, opts.Provider, opts.Providers, opts.DeletedWith, opts.Protect} {
 		if err := b.bind(e); err != nil {
 			return err
 		}
@@ -628,6 +741,36 @@ func (b *Decl) bindResourceOptions(opts ast.ResourceOptionsDecl) error {
 	return nil
 }
 
+// isRead returns true if a resource reads an existing resource with `get`,
+// instead of creating a new one.
+func isRead(r *ast.ResourceDecl) bool {
+	return r != nil && r.Get.Syntax() != nil
+}
+
+// Bind the `get` block of a resource that reads an existing resource.
+func (b *Decl) bindResourceGet(r ast.ResourcesMapEntry) error {
+	if !isRead(r.Value) {
+		return nil
+	}
+	get := r.Value.Get
+	loc := get.Syntax().Syntax().Range()
+	if len(r.Value.Properties.Entries) > 0 {
+		b.diags = append(b.diags, propertiesIgnoredByReadDiag(r.Key.Value, loc))
+	}
+	if get.Id == nil {
+		b.diags = append(b.diags, missingReadIDDiag(r.Key.Value, loc))
+	}
+	if err := b.bind(get.Id); err != nil {
+		return err
+	}
+	for _, entry := range get.State.Entries {
+		if err := b.bind(entry.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *Decl) bindPropertyAccess(p *ast.PropertyAccess, loc *hcl.Range) error {
 	l := p.Accessors
 	if len(l) == 0 {
@@ -3,13 +3,18 @@
 package bind
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/blang/semver"
 	"github.com/hashicorp/hcl/v2"
 	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
 	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/testing/utils"
 	"github.com/stretchr/testify/assert"
@@ -17,6 +22,7 @@ import (
 	"go.lsp.dev/protocol"
 
 	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
 )
 
 const awsEksExample = `
@@ -113,7 +119,7 @@ func TestBind(t *testing.T) {
 	require.NoError(t, err)
 	diags := decl.Diags()
 	require.Len(t, diags, 0)
-	decl.LoadSchema(rootPluginLoader)
+	decl.LoadSchema(context.Background(), rootPluginLoader)
 	diags = decl.Diags()
 	require.Len(t, diags, 1)
 	assert.Equal(t, &hcl.Diagnostic{
@@ -154,3 +160,708 @@ func newPluginLoader() schema.ReferenceLoader {
 }
 
 var rootPluginLoader schema.ReferenceLoader = newPluginLoader()
+
+func TestDependencyCycle(t *testing.T) {
+	doc := newDocument("dependency-cycle", `
+variables:
+  a: ${b}
+  b: ${c.id}
+  self: ${self}
+resources:
+  c:
+    type: test:index:Resource
+    options:
+      dependsOn:
+        - ${a}
+  d:
+    type: test:index:Resource
+    properties:
+      value: ${a}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	cycles := map[string][]string{}
+	for _, diag := range decl.Diags() {
+		if !strings.HasPrefix(diag.Detail, "Dependency cycle: ") {
+			continue
+		}
+		extra, ok := Extra(diag)
+		require.True(t, ok)
+		related := []string{}
+		for _, r := range extra.Related {
+			related = append(related, r.Message)
+		}
+		cycles[diag.Summary] = related
+		assert.Equal(t, diag.Detail, map[bool]string{
+			true:  "Dependency cycle: self -> self",
+			false: "Dependency cycle: a -> b -> c -> a",
+		}[diag.Summary == "'self' depends on itself"])
+	}
+	assert.Equal(t, map[string][]string{
+		"'a' depends on itself":    {"'c' references 'a'", "'a' references 'b'", "'b' references 'c'"},
+		"'b' depends on itself":    {"'c' references 'a'", "'a' references 'b'", "'b' references 'c'"},
+		"'c' depends on itself":    {"'c' references 'a'", "'a' references 'b'", "'b' references 'c'"},
+		"'self' depends on itself": {"'self' references 'self'"},
+	}, cycles)
+}
+
+// `c` is only part of a cycle through definitions that are part of a smaller
+// cycle: a -> b -> a and a -> c -> b -> a.
+func TestDependencyCycleThroughVisited(t *testing.T) {
+	doc := newDocument("dependency-cycle-visited", `
+variables:
+  a:
+    - ${b}
+    - ${c}
+  b: ${a}
+  c: ${b}
+  d: ${a}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	cycles := map[string]string{}
+	for _, diag := range decl.Diags() {
+		if strings.HasPrefix(diag.Detail, "Dependency cycle: ") {
+			cycles[diag.Summary] = diag.Detail
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"'a' depends on itself": "Dependency cycle: a -> b -> a",
+		"'b' depends on itself": "Dependency cycle: a -> b -> a",
+		"'c' depends on itself": "Dependency cycle: a -> c -> b -> a",
+	}, cycles)
+}
+
+func TestConfigTypes(t *testing.T) {
+	doc := newDocument("config-types", `
+name: test
+config:
+  str:
+    type: String
+  flags:
+    type: List<Boolean>
+    default: [true, 3]
+  count:
+    type: Integer
+    default: 1.5
+  obj:
+    type: Object
+  password:
+    type: String
+    secret: true
+  bad:
+    type: Strin
+  names:
+    type: array
+    items:
+      type: string
+  test:inferred: 3
+  aws:region: us-west-2
+outputs:
+  all:
+    - ${str}
+    - ${flags}
+    - ${count}
+    - ${obj}
+    - ${password}
+    - ${bad}
+    - ${names}
+    - ${inferred}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	typeOf := func(name string) string {
+		v, ok := decl.variables[name]
+		require.True(t, ok, name)
+		typ := v.definition.ResolveType(decl)
+		if typ == nil {
+			return "<nil>"
+		}
+		return typ.String()
+	}
+	assert.Equal(t, "string", typeOf("str"))
+	assert.Equal(t, "Array<boolean>", typeOf("flags"))
+	assert.Equal(t, "integer", typeOf("count"))
+	assert.IsType(t, &schema.MapType{}, decl.variables["obj"].definition.ResolveType(decl))
+	assert.Equal(t, "Array<string>", typeOf("names"))
+	assert.Equal(t, "number", typeOf("inferred"))
+	assert.Equal(t, "<nil>", typeOf("bad"))
+	assert.True(t, decl.variables["password"].definition.(*ConfigMapEntry).IsSecret())
+	assert.NotContains(t, decl.variables, "aws:region")
+
+	summaries := []string{}
+	for _, d := range decl.Diags() {
+		summaries = append(summaries, d.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"Default value for 'flags' must be of type List<boolean>",
+		"Default value for 'count' must be of type integer",
+		"Unknown configuration type 'Strin'",
+	}, summaries)
+}
+
+func TestResourceOptions(t *testing.T) {
+	doc := newDocument("resource-options", `
+name: test
+config:
+  shouldProtect:
+    type: string
+variables:
+  label: hello
+resources:
+  bucket:
+    type: aws:s3:Bucket
+  awsProvider:
+    type: pulumi:providers:aws
+  gcpProvider:
+    type: pulumi:providers:gcp
+  good:
+    type: aws:s3:BucketObject
+    options:
+      dependsOn: [ "${bucket}" ]
+      parent: ${bucket}
+      provider: ${awsProvider}
+      providers:
+        aws: ${awsProvider}
+      protect: true
+  bad:
+    type: aws:s3:BucketObject
+    options:
+      dependsOn:
+        - ${label}
+        - ${shouldProtect}
+      deletedWith: ${label}
+      provider: ${gcpProvider}
+      providers:
+        aws:s3: ${awsProvider}
+        gcp: ${bucket}
+      protect: ${shouldProtect}
+outputs:
+  label: ${label}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, diag.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"'dependsOn' must reference a resource",
+		"'dependsOn' must reference a resource",
+		"'deletedWith' must reference a resource",
+		"Provider 'gcpProvider' is for package 'gcp', not 'aws'",
+		"'aws:s3' is not a package name",
+		"'bucket' is not a provider resource",
+		"'protect' must be a boolean value",
+	}, summaries)
+}
+
+func TestPropertyPaths(t *testing.T) {
+	loader := testutil.Loader(testutil.Package())
+
+	doc := newDocument("property-paths", `
+resources:
+  res:
+    type: test:index:Resource
+    options:
+      ignoreChanges:
+        - tags.owner
+        - rules[0].port
+        - rules[0].hostname
+        - rules[*].port
+      replaceOnChanges:
+        - rules[0].port.value
+      additionalSecretOutputs:
+        - arn
+        - tags
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), loader)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, diag.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		// Paths are checked against the input shape of objects.
+		"Property 'hostname' does not exist on test:index:Rule•Input",
+		// Accessing a property of a primitive value is not reported:
+		// rules[0].port.value.
+		"Property 'tags' does not exist on test:index:Resource",
+	}, summaries)
+}
+
+func TestCustomTimeouts(t *testing.T) {
+	doc := newDocument("custom-timeouts", `
+resources:
+  res:
+    type: test:index:Resource
+    options:
+      customTimeouts:
+        create: 1h30m
+        update: ten minutes
+        delete: ""
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	diags := decl.Diags()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "Invalid duration 'ten minutes' for 'update'", diags[0].Summary)
+	assert.Equal(t, 8, diags[0].Subject.Start.Line)
+}
+
+func TestResourceRead(t *testing.T) {
+	// `arn` is required, so reading it is not optional.
+	pkg := testutil.Package()
+	res := pkg.Resources["test:index:Resource"]
+	res.Required = []string{"arn"}
+	pkg.Resources["test:index:Resource"] = res
+	loader := testutil.Loader(pkg)
+
+	doc := newDocument("resource-read", `
+variables:
+  arn: ${existing.arn}
+resources:
+  existing:
+    type: test:index:Resource
+    get:
+      id: some-id
+      state:
+        arn: some-arn
+        owner: me
+  both:
+    type: test:index:Resource
+    properties:
+      name: both
+    get:
+      state:
+        arn: ${arn}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), loader)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, diag.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"Resource both sets both 'properties' and 'get'",
+		"Resource both is missing 'get.id'",
+		"Property 'owner' does not exist on test:index:Resource",
+	}, summaries)
+
+	// References to read resources are typed by their outputs.
+	assert.Equal(t, schema.StringType, decl.variables["arn"].definition.ResolveType(decl))
+}
+
+func TestSecrets(t *testing.T) {
+	loader := testutil.Loader(testutil.Package())
+
+	doc := newDocument("secrets", `
+config:
+  dbPassword:
+    type: String
+    secret: true
+resources:
+  db:
+    type: test:index:Database
+    properties:
+      name: db
+      password: hunter2
+      users:
+        - name: admin
+          password: ${dbPassword}
+        - name: reader
+          password: 12345
+outputs:
+  endpoint: ${db.endpoint}
+  connection: ${db.connectionString}
+  password:
+    fn::join: [":", ["admin", "${dbPassword}"]]
+  hidden:
+    fn::secret: ${dbPassword}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), loader)
+
+	summaries := []string{}
+	var plaintext []*PlaintextSecret
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, fmt.Sprintf("%d: %s", diag.Subject.Start.Line, diag.Summary))
+		if extra, ok := Extra(diag); ok && extra.Secret != nil {
+			plaintext = append(plaintext, extra.Secret)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"11: Plaintext value for secret property 'password'",
+		"16: Plaintext value for secret property 'password'",
+		"19: Output 'connection' exposes a secret",
+		"21: Output 'password' exposes a secret",
+	}, summaries)
+
+	require.Len(t, plaintext, 4)
+	assert.Equal(t, "dbPassword2", plaintext[0].ConfigName)
+	assert.Equal(t, "String", plaintext[0].ConfigType)
+	assert.Equal(t, "Number", plaintext[1].ConfigType)
+	// Outputs can only be wrapped in `fn::secret`.
+	assert.Empty(t, plaintext[2].ConfigName)
+}
+
+func TestFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html/>"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "www"), 0o700))
+
+	doc := newDocument(filepath.Join(dir, "Pulumi.yaml"), `
+variables:
+  page:
+    fn::readFile: ./index.html
+  missing:
+    fn::readFile: ${pulumi.cwd}/missing.html
+  dir:
+    fn::readFile: www
+  unknown:
+    fn::readFile: ${page}/file
+outputs:
+  assets:
+    fn::assetArchive:
+      site:
+        fn::fileArchive: ./www
+      page:
+        fn::fileAsset: ./www/index.html
+  page: ${page}
+  missing: ${missing}
+  dir: ${dir}
+  unknown: ${unknown}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, fmt.Sprintf("%d: %s", diag.Subject.Start.Line, diag.Summary))
+	}
+	assert.ElementsMatch(t, []string{
+		fmt.Sprintf("6: '%s' does not exist", filepath.Join(dir, "missing.html")),
+		fmt.Sprintf("8: '%s' is a directory", filepath.Join(dir, "www")),
+		fmt.Sprintf("17: '%s' does not exist", filepath.Join(dir, "www", "index.html")),
+	}, summaries)
+
+	paths := []string{}
+	for _, f := range decl.FilePaths() {
+		paths = append(paths, f.Builtin+" "+f.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"fn::readFile " + filepath.Join(dir, "index.html"),
+		"fn::readFile " + filepath.Join(dir, "missing.html"),
+		"fn::readFile " + filepath.Join(dir, "www"),
+		// Paths that depend on other values are not resolved.
+		"fn::readFile ",
+		"fn::fileArchive " + filepath.Join(dir, "www"),
+		"fn::fileAsset " + filepath.Join(dir, "www", "index.html"),
+	}, paths)
+}
+
+func TestCheckInstalledVersions(t *testing.T) {
+	doc := newDocument("Pulumi.yaml", `
+resources:
+  installed:
+    type: aws:s3:Bucket
+    options:
+      version: 5.16.2
+  missing:
+    type: pulumi:providers:aws
+    options:
+      version: "4.0.0"
+  unknown:
+    type: gcp:storage:Bucket
+    options:
+      version: 6.0.0
+variables:
+  vpc:
+    fn::invoke:
+      function: aws:ec2:getVpc
+      options:
+        version: v5.1.0
+outputs:
+  vpc: ${vpc}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.CheckInstalledVersions(map[string][]semver.Version{
+		"aws": {semver.MustParse("5.16.2"), semver.MustParse("5.1.0")},
+	})
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		if extra, ok := Extra(diag); ok && extra.VersionConflict != nil {
+			// The pinned versions also conflict with each other.
+			continue
+		}
+		assert.Equal(t, hcl.DiagWarning, diag.Severity)
+		summaries = append(summaries, fmt.Sprintf("%d: %s (%s)", diag.Subject.Start.Line, diag.Summary, diag.Detail))
+	}
+	assert.Equal(t, []string{
+		"10: Version 4.0.0 of 'aws' is not installed (Installed versions: 5.16.2, 5.1.0)",
+		"14: Version 6.0.0 of 'gcp' is not installed (No version of the 'gcp' plugin is installed)",
+	}, summaries)
+}
+
+func TestVersionConflicts(t *testing.T) {
+	doc := newDocument("Pulumi.yaml", `
+plugins:
+  providers:
+    - name: aws
+      path: ../pulumi-aws/bin
+      version: 4.0.0
+resources:
+  default:
+    type: aws:s3:Bucket
+  pinned:
+    type: aws:s3:Bucket
+    options:
+      version: 5.16.2
+  provider:
+    type: pulumi:providers:aws
+    options:
+      version: v5.16.2
+  other:
+    type: gcp:storage:Bucket
+    options:
+      version: 6.0.0
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		extra, ok := Extra(diag)
+		require.True(t, ok)
+		require.NotNil(t, extra.VersionConflict)
+		assert.Equal(t, []string{"4.0.0", "5.16.2"}, extra.VersionConflict.Versions())
+		related := []string{}
+		for _, r := range extra.Related {
+			related = append(related, fmt.Sprintf("%d: %s", r.Range.Start.Line, r.Message))
+		}
+		summaries = append(summaries, fmt.Sprintf("%d: %s (%s) [%s]",
+			diag.Subject.Start.Line, diag.Summary, diag.Detail, strings.Join(related, "; ")))
+	}
+	assert.Equal(t, []string{
+		"6: Conflicting versions of 'aws' ('aws' is used at 4.0.0, 5.16.2, the default version. " +
+			"Each version loads a separate schema and plugin) " +
+			"[9: 'aws' is used at the default version here; 13: 'aws' is used at version 5.16.2 here; " +
+			"17: 'aws' is used at version v5.16.2 here]",
+		"13: Conflicting versions of 'aws' ('aws' is used at 4.0.0, 5.16.2, the default version. " +
+			"Each version loads a separate schema and plugin) " +
+			"[6: 'aws' is used at version 4.0.0 here; 9: 'aws' is used at the default version here]",
+		"17: Conflicting versions of 'aws' ('aws' is used at 4.0.0, 5.16.2, the default version. " +
+			"Each version loads a separate schema and plugin) " +
+			"[6: 'aws' is used at version 4.0.0 here; 9: 'aws' is used at the default version here]",
+	}, summaries)
+}
+
+func TestObjectVariableTypes(t *testing.T) {
+	doc := newDocument("Pulumi.yaml", `
+variables:
+  settings:
+    name: web
+    ports:
+      - number: 80
+outputs:
+  name: ${settings.name}
+  port: ${settings.ports[0].number}
+  missing: ${settings.nmae}
+  nested: ${settings.ports[0].host}
+  primitive: ${settings.name.length}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), nil)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, fmt.Sprintf("%d: %s", diag.Subject.Start.Line, diag.Summary))
+	}
+	assert.ElementsMatch(t, []string{
+		"10: Property 'nmae' does not exist on {name: string, ports: List<{number: number}>}",
+		"11: Property 'host' does not exist on {number: number}",
+		// Accessing a property of a primitive value is not reported.
+	}, summaries)
+}
+
+func TestInferTypes(t *testing.T) {
+	// Outputs of every shape are read from the resource.
+	pkg := testutil.Package()
+	outputs := pkg.Resources["test:index:Resource"].Properties
+	inputs := pkg.Resources["test:index:Resource"].InputProperties
+	outputs["tags"], outputs["rules"] = inputs["tags"], inputs["rules"]
+	loader := testutil.Loader(pkg)
+	doc := newDocument("Pulumi.yaml", `
+resources:
+  res:
+    type: test:index:Resource
+  db:
+    type: test:index:Database
+    options:
+      dependsOn:
+        - fn::select: [0, "${res.arn}"]
+variables:
+  parts:
+    fn::split: [",", "a,b"]
+  first:
+    fn::select: [0, "${parts}"]
+  rule:
+    fn::select: [0, "${res.rules}"]
+  port: ${rule.port}
+  hidden:
+    fn::secret:
+      a: 1
+  hiddenA: ${hidden.a}
+  connection: ${db.connectionString}
+  mixed: [1, "a", 2]
+  json:
+    fn::toJSON: ${res.tags}
+outputs:
+  first: ${first}
+  port: ${port}
+  hidden:
+    fn::secret: ${hidden}
+  secrets:
+    fn::secret: ["${hiddenA}", "${connection}"]
+  mixed: ${mixed}
+  json: ${json}
+  interpolated: prefix-${res.rules}
+  selected:
+    fn::select: [0, "${res.arn}"]
+  split:
+    fn::split: [",", "${res.tags}"]
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), loader)
+
+	typeOf := func(name string) string {
+		return diags.DisplayType(decl.Variables()[name].Source().ResolveType(decl))
+	}
+	assert.Equal(t, "List<string>", typeOf("parts"))
+	assert.Equal(t, "string", typeOf("first"))
+	assert.Equal(t, "test:index:Rule", typeOf("rule"))
+	assert.Equal(t, "integer", typeOf("port"))
+	// Secrets are marked, and reading from a secret or a secret property gives
+	// a secret.
+	assert.Equal(t, "Secret<{a: number}>", typeOf("hidden"))
+	assert.Equal(t, "Secret<number>", typeOf("hiddenA"))
+	assert.Equal(t, "Secret<string>", typeOf("connection"))
+	assert.Equal(t, "List<Union<number, string>>", typeOf("mixed"))
+	assert.Equal(t, "string", typeOf("json"))
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		summaries = append(summaries, fmt.Sprintf("%d: %s (%s)", diag.Subject.Start.Line, diag.Summary, diag.Detail))
+	}
+	assert.Equal(t, []string{
+		// Builtins in resource options are checked too.
+		"9: fn::select expects a list (fn::select expects a list, but this value has type string)",
+		"35: Cannot interpolate 'res.rules' into a string ('res.rules' has type List<test:index:Rule>. " +
+			"Only strings, numbers and booleans can be interpolated)",
+		"37: fn::select expects a list (fn::select expects a list, but this value has type string)",
+		"39: fn::split expects a string (fn::split expects a string, but this value has type Map<string>)",
+	}, summaries)
+}
+
+func TestTypeWrappers(t *testing.T) {
+	plain := &schema.ObjectType{Token: "test:index:Rule"}
+	input := &schema.ObjectType{Token: "test:index:Rule", PlainShape: plain}
+	rules := &schema.InputType{ElementType: &schema.ArrayType{ElementType: &schema.InputType{ElementType: input}}}
+
+	// Inputs are resolved to the plain values a template reads.
+	resolved, ok := resolvedType(rules).(*schema.ArrayType)
+	require.True(t, ok)
+	assert.Same(t, plain, resolved.ElementType)
+	assert.Same(t, plain, resolvedType(&schema.InputType{ElementType: input}))
+
+	// Secrets survive resolution, and are looked through by UnwrapType.
+	hidden := secret(&schema.InputType{ElementType: schema.StringType})
+	assert.True(t, IsSecret(hidden))
+	assert.True(t, IsSecret(&schema.OptionalType{ElementType: hidden}))
+	assert.Equal(t, schema.StringType, UnwrapType(hidden))
+	assert.Equal(t, "Secret<string>", diags.DisplayType(resolvedType(hidden)))
+	assert.Same(t, hidden, secret(hidden), "secrets are not wrapped twice")
+	assert.Equal(t, "Secret<any>", diags.DisplayType(secret(nil)))
+	assert.False(t, IsSecret(rules))
+}
+
+func TestDiagnosticExtras(t *testing.T) {
+	pkg := testutil.Package()
+	pkg.Resources["test:index:Old"] = schema.ResourceSpec{DeprecationMessage: "Use test:index:Resource"}
+	pkg.Resources["test:index:Resource"].InputProperties["oldName"] = schema.PropertySpec{
+		TypeSpec: schema.TypeSpec{Type: "string"}, DeprecationMessage: "Use name",
+	}
+	pkg.Functions["test:index:getOld"] = schema.FunctionSpec{DeprecationMessage: "Use getNew"}
+	loader := testutil.Loader(pkg)
+	doc := newDocument("Pulumi.yaml", `
+variables:
+  unused: 1
+  dup: 2
+  old:
+    fn::invoke:
+      function: test:index:getOld
+resources:
+  dup:
+    type: test:index:Resource
+  legacy:
+    type: test:index:Old
+  res:
+    type: test:index:Resource
+    properties:
+      oldName: ${dup}-${old}-${legacy.id}
+`)
+	parsed := cleanParse(t, doc)
+	decl, err := NewDecl(parsed)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), loader)
+
+	summaries := []string{}
+	for _, diag := range decl.Diags() {
+		extra, _ := Extra(diag)
+		summary := fmt.Sprintf("%d: %s", diag.Subject.Start.Line, diag.Summary)
+		if extra.Unnecessary {
+			summary += " [unnecessary]"
+		}
+		if extra.Deprecated {
+			summary += " [deprecated]"
+		}
+		for _, r := range extra.Related {
+			summary += fmt.Sprintf(" (%d: %s)", r.Range.Start.Line, r.Message)
+		}
+		summaries = append(summaries, summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"3: Variable 'unused' is unused [unnecessary]",
+		"9: Duplicate Binding (4: 'dup' is first bound here)",
+		"7: 'test:index:getOld' is depreciated [deprecated]",
+		"12: 'test:index:Old' is depreciated [deprecated]",
+		"16: 'oldName' is depreciated [deprecated]",
+	}, summaries)
+}
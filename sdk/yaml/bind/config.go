@@ -0,0 +1,218 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"math"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// The type names accepted by the `type` field of a configuration entry,
+// excluding `List<...>` types.
+var configTypeNames = map[string]schema.Type{
+	"string":  schema.StringType,
+	"number":  schema.NumberType,
+	"int":     schema.IntType,
+	"integer": schema.IntType,
+	"bool":    schema.BoolType,
+	"boolean": schema.BoolType,
+	"object":  &schema.MapType{ElementType: schema.AnyType},
+}
+
+// The valid configuration types, as displayed to the user.
+const validConfigTypes = "String, Number, Integer, Boolean, Object, List<String>, List<Number>, " +
+	"List<Integer>, List<Boolean>"
+
+// parseConfigType parses the type of a configuration entry. Types are case
+// insensitive, and may be list types (`List<String>`), or `array` with an
+// `items` type.
+func parseConfigType(typ string, items *ast.ConfigParamDecl) (schema.Type, bool) {
+	s := strings.ToLower(strings.TrimSpace(typ))
+	if strings.HasPrefix(s, "list<") && strings.HasSuffix(s, ">") {
+		inner, ok := parseConfigType(strings.TrimSuffix(strings.TrimPrefix(s, "list<"), ">"), nil)
+		if !ok {
+			return nil, false
+		}
+		return &schema.ArrayType{ElementType: inner}, true
+	}
+	if s == "array" {
+		if items == nil || items.Type == nil {
+			return &schema.ArrayType{ElementType: schema.AnyType}, true
+		}
+		inner, ok := parseConfigType(items.Type.Value, items.Items)
+		if !ok {
+			return nil, false
+		}
+		return &schema.ArrayType{ElementType: inner}, true
+	}
+	t, ok := configTypeNames[s]
+	return t, ok
+}
+
+// The type of a configuration entry. An entry without a declared type takes the
+// type of its value or default. A nil type is returned if the type is unknown.
+func (c *ConfigMapEntry) configType() schema.Type {
+	if c.Value == nil {
+		return nil
+	}
+	if c.Value.Type != nil {
+		t, _ := parseConfigType(c.Value.Type.Value, c.Value.Items)
+		return t
+	}
+	for _, e := range []ast.Expr{c.Value.Value, c.Value.Default} {
+		if t := literalType(e); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// IsSecret returns true if the configuration entry is marked `secret: true`.
+func (c *ConfigMapEntry) IsSecret() bool {
+	return c.Value != nil && c.Value.Secret != nil && c.Value.Secret.Value
+}
+
+// The type of a literal value, or nil if `e` is not a literal.
+func literalType(e ast.Expr) schema.Type {
+	switch e := e.(type) {
+	case *ast.StringExpr:
+		return schema.StringType
+	case *ast.NumberExpr:
+		return schema.NumberType
+	case *ast.BooleanExpr:
+		return schema.BoolType
+	case *ast.ListExpr:
+		var element schema.Type = schema.AnyType
+		if len(e.Elements) > 0 {
+			if t := literalType(e.Elements[0]); t != nil {
+				element = t
+			}
+		}
+		return &schema.ArrayType{ElementType: element}
+	case *ast.ObjectExpr:
+		return &schema.MapType{ElementType: schema.AnyType}
+	default:
+		return nil
+	}
+}
+
+// Validate the declaration of a configuration entry: its type must be known,
+// and its default value must match its type.
+func (b *Decl) validateConfig(c *ConfigMapEntry) {
+	if c.Value == nil || c.Value.Type == nil {
+		return
+	}
+	typ, ok := parseConfigType(c.Value.Type.Value, c.Value.Items)
+	if !ok {
+		b.diags = append(b.diags, unknownConfigTypeDiag(c.Value.Type.Value, validConfigTypes,
+			c.Value.Type.Syntax().Syntax().Range()))
+		return
+	}
+	if c.Value.Default == nil {
+		return
+	}
+	if e, ok := mismatchedLiteral(c.Value.Default, typ); ok {
+		var loc *hcl.Range
+		if s := e.Syntax(); s != nil && s.Syntax() != nil {
+			loc = s.Syntax().Range()
+		}
+		b.diags = append(b.diags, configDefaultTypeDiag(c.Key.Value, diags.DisplayType(typ), loc))
+	}
+}
+
+// mismatchedLiteral finds the part of a literal expression that does not
+// conform to `typ`. Non-literal expressions are assumed to conform.
+func mismatchedLiteral(e ast.Expr, typ schema.Type) (ast.Expr, bool) {
+	switch typ := typ.(type) {
+	case *schema.ArrayType:
+		l, ok := e.(*ast.ListExpr)
+		if !ok {
+			return e, literalType(e) != nil
+		}
+		for _, el := range l.Elements {
+			if bad, ok := mismatchedLiteral(el, typ.ElementType); ok {
+				return bad, true
+			}
+		}
+		return nil, false
+	case *schema.MapType:
+		if _, ok := e.(*ast.ObjectExpr); ok {
+			return nil, false
+		}
+		return e, literalType(e) != nil
+	}
+
+	switch typ {
+	case schema.AnyType:
+		return nil, false
+	case schema.StringType:
+		_, ok := e.(*ast.StringExpr)
+		return e, !ok && literalType(e) != nil
+	case schema.NumberType:
+		_, ok := e.(*ast.NumberExpr)
+		return e, !ok && literalType(e) != nil
+	case schema.IntType:
+		n, ok := e.(*ast.NumberExpr)
+		if ok {
+			return e, n.Value != math.Trunc(n.Value)
+		}
+		return e, literalType(e) != nil
+	case schema.BoolType:
+		_, ok := e.(*ast.BooleanExpr)
+		return e, !ok && literalType(e) != nil
+	}
+	return nil, false
+}
+
+// The name a configuration entry from the `config` block is bound to, if it is
+// bound at all. Keys are either bare (`key`), or namespaced by the project
+// (`project:key`). Keys in other namespaces configure providers, and cannot be
+// referenced.
+func configVariableName(project *ast.StringExpr, key string) (string, bool) {
+	if !strings.Contains(key, ":") {
+		return key, true
+	}
+	if project != nil && strings.HasPrefix(key, project.Value+":") {
+		return strings.TrimPrefix(key, project.Value+":"), true
+	}
+	return "", false
+}
+
+// ProjectConfig returns the configuration declared by a project, keyed by the
+// name it is referenced by. Provider configuration is not included.
+func ProjectConfig(decl *ast.TemplateDecl) map[string]*ConfigMapEntry {
+	m := map[string]*ConfigMapEntry{}
+	if decl == nil {
+		return m
+	}
+	for _, c := range append(append([]ast.ConfigMapEntry{}, decl.Configuration.Entries...), decl.Config.Entries...) {
+		if name, ok := configVariableName(decl.Name, c.Key.Value); ok {
+			if _, exists := m[name]; !exists {
+				m[name] = &ConfigMapEntry{c}
+			}
+		}
+	}
+	return m
+}
+
+// Required returns true if a value must be provided for the configuration entry,
+// because it has neither a default nor a value.
+func (c *ConfigMapEntry) Required() bool {
+	return c.Value == nil || (c.Value.Default == nil && c.Value.Value == nil)
+}
+
+// MismatchedValue checks a literal value provided for the configuration entry
+// against its type. If the value does not conform, the offending part of the
+// value is returned. Values that are not literals are assumed to conform.
+func (c *ConfigMapEntry) MismatchedValue(value ast.Expr) (ast.Expr, bool) {
+	typ := c.configType()
+	if typ == nil {
+		return nil, false
+	}
+	return mismatchedLiteral(value, typ)
+}
@@ -4,13 +4,42 @@ package bind
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/blang/semver"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
 	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 )
 
+// RelatedInformation points to a location that is relevant to a diagnostic.
+type RelatedInformation struct {
+	Message string
+	Range   *hcl.Range
+}
+
+// DiagnosticExtra holds the information attached to the `Extra` field of the
+// diagnostics produced by this package.
+type DiagnosticExtra struct {
+	Related []RelatedInformation
+	// Set on diagnostics about secrets that are exposed in plaintext.
+	Secret *PlaintextSecret
+	// Set on diagnostics about a package used at different versions.
+	VersionConflict *VersionConflict
+	// The diagnostic is about code that has no effect, such as an unused
+	// variable.
+	Unnecessary bool
+	// The diagnostic is about a deprecated resource, function or property.
+	Deprecated bool
+}
+
+// Extra retrieves the extra information attached to a diagnostic, if any.
+func Extra(diag *hcl.Diagnostic) (DiagnosticExtra, bool) {
+	extra, ok := diag.Extra.(DiagnosticExtra)
+	return extra, ok
+}
+
 func propertyStartsWithIndexDiag(p *ast.PropertyAccess, loc *hcl.Range) *hcl.Diagnostic {
 	return &hcl.Diagnostic{
 		Severity: hcl.DiagWarning,
@@ -27,6 +56,10 @@ func duplicateSourceDiag(name string, subject *hcl.Range, prev *hcl.Range) *hcl.
 		Detail:   fmt.Sprintf("'%s' has already been bound", name),
 		Subject:  subject,
 		Context:  prev,
+		Extra: DiagnosticExtra{Related: []RelatedInformation{{
+			Message: fmt.Sprintf("'%s' is first bound here", name),
+			Range:   prev,
+		}}},
 	}
 }
 
@@ -85,6 +118,7 @@ func unusedVariableDiag(name string, loc *hcl.Range) *hcl.Diagnostic {
 		Severity: hcl.DiagWarning,
 		Summary:  fmt.Sprintf("Variable '%s' is unused", name),
 		Subject:  loc,
+		Extra:    DiagnosticExtra{Unnecessary: true},
 	}
 }
 
@@ -125,6 +159,7 @@ func depreciatedDiag(item, msg string, loc *hcl.Range) *hcl.Diagnostic {
 		Summary:  fmt.Sprintf("'%s' is depreciated", item),
 		Detail:   msg,
 		Subject:  loc,
+		Extra:    DiagnosticExtra{Deprecated: true},
 	}
 }
 
@@ -159,3 +194,213 @@ func missingResourceTypeDiag(name string, loc *hcl.Range) *hcl.Diagnostic {
 		Subject:  loc,
 	}
 }
+
+func dependencyCycleDiag(name, cycle string, loc *hcl.Range, related []RelatedInformation) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("'%s' depends on itself", name),
+		Detail:   fmt.Sprintf("Dependency cycle: %s", cycle),
+		Subject:  loc,
+		Extra:    DiagnosticExtra{Related: related},
+	}
+}
+
+func unknownConfigTypeDiag(typ, valid string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Unknown configuration type '%s'", typ),
+		Detail:   fmt.Sprintf("Valid types are %s", valid),
+		Subject:  loc,
+	}
+}
+
+func configDefaultTypeDiag(name, typ string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Default value for '%s' must be of type %s", name, typ),
+		Subject:  loc,
+	}
+}
+
+func notResourceDiag(option, found string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("'%s' must reference a resource", option),
+		Detail:   fmt.Sprintf("Found %s", found),
+		Subject:  loc,
+	}
+}
+
+func notResourceListDiag(option, found string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("'%s' must be a list of resources", option),
+		Detail:   fmt.Sprintf("Found %s", found),
+		Subject:  loc,
+	}
+}
+
+func notProviderDiag(name, token string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("'%s' is not a provider resource", name),
+		Detail: fmt.Sprintf("'%s' has type '%s', but provider resources have type '%s<package>'",
+			name, token, providerTypePrefix),
+		Subject: loc,
+	}
+}
+
+func providerPackageMismatchDiag(name, providerPkg, pkg string, loc, provider *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Provider '%s' is for package '%s', not '%s'", name, providerPkg, pkg),
+		Subject:  loc,
+		Extra: DiagnosticExtra{Related: []RelatedInformation{{
+			Message: fmt.Sprintf("'%s' is declared here", name),
+			Range:   provider,
+		}}},
+	}
+}
+
+func providersKeyDiag(key string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("'%s' is not a package name", key),
+		Detail:   "The keys of 'providers' are the names of the packages each provider is used for, such as 'aws'",
+		Subject:  loc,
+	}
+}
+
+func protectTypeDiag(found string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "'protect' must be a boolean value",
+		Detail:   fmt.Sprintf("Found %s", found),
+		Subject:  loc,
+	}
+}
+
+func invalidPropertyPathDiag(path string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Invalid property path '%s'", path),
+		Detail:   "Property paths look like 'a.b[0].c'",
+		Subject:  loc,
+	}
+}
+
+func invalidDurationDiag(name, value string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Invalid duration '%s' for '%s'", value, name),
+		Detail:   "Durations are a sequence of numbers with units, such as '10m' or '1h30m'. Valid units are 'ns', 'us', 'ms', 's', 'm' and 'h'",
+		Subject:  loc,
+	}
+}
+
+func propertiesIgnoredByReadDiag(name string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Resource %s sets both 'properties' and 'get'", name),
+		Detail:   "A resource with 'get' reads an existing resource, so its 'properties' are ignored",
+		Subject:  loc,
+	}
+}
+
+func missingReadIDDiag(name string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Resource %s is missing 'get.id'", name),
+		Detail:   "Reading an existing resource requires its ID",
+		Subject:  loc,
+	}
+}
+
+func plaintextSecretDiag(prop, resource string, loc *hcl.Range, secret PlaintextSecret) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Plaintext value for secret property '%s'", prop),
+		Detail: fmt.Sprintf("'%s' is a secret property of '%s', but its value is written in plaintext. "+
+			"Wrap the value in 'fn::secret', or read it from secret configuration", prop, resource),
+		Subject: loc,
+		Extra:   DiagnosticExtra{Secret: &secret},
+	}
+}
+
+func exposedSecretOutputDiag(output, secret string, loc *hcl.Range, value PlaintextSecret) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Output '%s' exposes a secret", output),
+		Detail:   fmt.Sprintf("'%s' references %s. Wrap the value in 'fn::secret' to keep it secret", output, secret),
+		Subject:  loc,
+		Extra:    DiagnosticExtra{Secret: &value},
+	}
+}
+
+func missingFileDiag(builtin, path string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("'%s' does not exist", path),
+		Detail:   fmt.Sprintf("The path given to '%s' is relative to the project directory", builtin),
+		Subject:  loc,
+	}
+}
+
+func fileIsDirectoryDiag(builtin, path string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("'%s' is a directory", path),
+		Detail:   fmt.Sprintf("'%s' reads a file. Use 'fn::fileArchive' to archive a directory", builtin),
+		Subject:  loc,
+	}
+}
+
+func versionNotInstalledDiag(pkg string, version semver.Version, installed []semver.Version, loc *hcl.Range) *hcl.Diagnostic {
+	detail := fmt.Sprintf("No version of the '%s' plugin is installed", pkg)
+	if len(installed) > 0 {
+		detail = fmt.Sprintf("Installed versions: %s", displayVersions(installed))
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Version %s of '%s' is not installed", version, pkg),
+		Detail:   detail,
+		Subject:  loc,
+	}
+}
+
+func conflictingVersionsDiag(use PackageUse, conflict VersionConflict, related []RelatedInformation) *hcl.Diagnostic {
+	versions := conflict.Versions()
+	for _, u := range conflict.Uses {
+		if u.Version == "" {
+			versions = append(versions, "the default version")
+			break
+		}
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Conflicting versions of '%s'", conflict.Package),
+		Detail: fmt.Sprintf("'%s' is used at %s. Each version loads a separate schema and plugin",
+			conflict.Package, strings.Join(versions, ", ")),
+		Subject: use.VersionRange,
+		Extra:   DiagnosticExtra{Related: related, VersionConflict: &conflict},
+	}
+}
+
+func structuredInterpolationDiag(access string, typ schema.Type, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Cannot interpolate '%s' into a string", access),
+		Detail: fmt.Sprintf("'%s' has type %s. Only strings, numbers and booleans can be interpolated",
+			access, diags.DisplayType(typ)),
+		Subject: loc,
+	}
+}
+
+func builtinArgumentTypeDiag(builtin, expected string, typ schema.Type, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("%s expects %s", builtin, expected),
+		Detail:   fmt.Sprintf("%s expects %s, but this value has type %s", builtin, expected, diags.DisplayType(typ)),
+		Subject:  loc,
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+)
+
+// FilePath is a path passed to `fn::readFile`, `fn::fileAsset` or
+// `fn::fileArchive`.
+type FilePath struct {
+	// The name of the builtin the path is passed to, such as `fn::readFile`.
+	Builtin string
+	// The expression giving the path.
+	Expr ast.Expr
+	// The absolute path, resolved relative to the project directory. Path is
+	// empty if it can't be known without running the program.
+	Path string
+}
+
+// AllowsDir returns true if the path may name a directory. Only archives can be
+// read from directories.
+func (f FilePath) AllowsDir() bool {
+	return f.Builtin == "fn::fileArchive"
+}
+
+// Record a path given to a file builtin.
+func (b *Decl) bindFilePath(builtin string, e ast.Expr) error {
+	b.filePaths = append(b.filePaths, FilePath{
+		Builtin: builtin,
+		Expr:    e,
+		Path:    ResolveFilePath(e),
+	})
+	return b.bind(e)
+}
+
+// ResolveFilePath resolves the path given by `e`. Relative paths are relative to
+// the project directory, which is also the value of `${pulumi.cwd}`. An empty
+// string is returned if the path can't be known without running the program.
+func ResolveFilePath(e ast.Expr) string {
+	loc := exprRange(e)
+	if loc == nil || loc.Filename == "" {
+		return ""
+	}
+	dir := filepath.Dir(loc.Filename)
+	var path string
+	switch e := e.(type) {
+	case *ast.StringExpr:
+		path = e.Value
+	case *ast.InterpolateExpr:
+		var b strings.Builder
+		for _, part := range e.Parts {
+			b.WriteString(part.Text)
+			if part.Value == nil {
+				continue
+			}
+			if part.Value.String() != pulumiyaml.PulumiVarName+".cwd" {
+				return ""
+			}
+			b.WriteString(dir)
+		}
+		path = b.String()
+	default:
+		return ""
+	}
+	if path == "" {
+		return ""
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// Check that the paths given to file builtins exist.
+func (b *Decl) checkFilePaths() {
+	for _, f := range b.filePaths {
+		if f.Path == "" {
+			continue
+		}
+		info, err := os.Stat(f.Path)
+		switch {
+		case err != nil:
+			b.diags = append(b.diags, missingFileDiag(f.Builtin, f.Path, exprRange(f.Expr)))
+		case info.IsDir() && !f.AllowsDir():
+			b.diags = append(b.diags, fileIsDirectoryDiag(f.Builtin, f.Path, exprRange(f.Expr)))
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// An edge in the dependency graph: the definition being bound references
+// `name` at `location`.
+type dependency struct {
+	name     string
+	location *hcl.Range
+}
+
+// Report every dependency cycle between variables and resources.
+//
+// Dependencies come from references in variable values, resource properties
+// and the `dependsOn`, `parent`, `provider(s)` and `deletedWith` resource
+// options. A definition is in a cycle if its strongly connected component has
+// more than one definition, or if it references itself. Each definition in a
+// cycle gets an error, with the path of the shortest cycle through it attached
+// as related information.
+//
+// Every definition in a cycle is added to `b.cyclic`, so type resolution stops
+// there instead of recursing forever.
+func (b *Decl) checkCycles() {
+	for _, component := range b.stronglyConnected() {
+		if len(component) == 1 && !b.referencesItself(component[0]) {
+			continue
+		}
+		members := map[string]bool{}
+		for _, name := range component {
+			members[name] = true
+			b.cyclic[name] = true
+		}
+		for _, name := range component {
+			b.reportCycle(name, b.shortestCycle(name, members))
+		}
+	}
+}
+
+// The dependencies of `name` on defined variables and resources. References to
+// missing variables are reported elsewhere.
+func (b *Decl) definedDependencies(name string) []dependency {
+	var deps []dependency
+	for _, dep := range b.dependencies[name] {
+		if v, ok := b.variables[dep.name]; ok && v.definition != nil {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+func (b *Decl) referencesItself(name string) bool {
+	for _, dep := range b.definedDependencies(name) {
+		if dep.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stronglyConnected returns the strongly connected components of the dependency
+// graph, found with Tarjan's algorithm. Components and the names in them are
+// sorted, so cycles are reported in a stable order.
+func (b *Decl) stronglyConnected() [][]string {
+	var (
+		next       int
+		index      = map[string]int{}
+		lowlink    = map[string]int{}
+		onStack    = map[string]bool{}
+		stack      []string
+		components [][]string
+	)
+	var connect func(name string)
+	connect = func(name string) {
+		index[name], lowlink[name] = next, next
+		next++
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, dep := range b.definedDependencies(name) {
+			if _, visited := index[dep.name]; !visited {
+				connect(dep.name)
+				lowlink[name] = min(lowlink[name], lowlink[dep.name])
+			} else if onStack[dep.name] {
+				lowlink[name] = min(lowlink[name], index[dep.name])
+			}
+		}
+		if lowlink[name] != index[name] {
+			return
+		}
+		// `name` is the root of a component, which is every name above it on
+		// the stack.
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		sort.Strings(component)
+		components = append(components, component)
+	}
+
+	names := make([]string, 0, len(b.dependencies))
+	for name := range b.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i][0] < components[j][0] })
+	return components
+}
+
+// shortestCycle finds the shortest cycle from `name` back to itself that stays
+// within `members`. Each element of the cycle is referenced by the element
+// before it, and the first element is referenced by the last.
+func (b *Decl) shortestCycle(name string, members map[string]bool) []dependency {
+	// The dependency each name was first reached by, and the name it was
+	// reached from.
+	reached := map[string]dependency{}
+	from := map[string]string{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range b.definedDependencies(current) {
+			if !members[dep.name] {
+				continue
+			}
+			if dep.name == name {
+				cycle := []dependency{dep}
+				for n := current; n != name; n = from[n] {
+					cycle = append(cycle, reached[n])
+				}
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, ok := reached[dep.name]; !ok {
+				reached[dep.name], from[dep.name] = dep, current
+				queue = append(queue, dep.name)
+			}
+		}
+	}
+	return nil
+}
+
+// Report that `name` is part of `cycle`. Each element of `cycle` is referenced
+// by the element before it, and the first element is referenced by the last.
+func (b *Decl) reportCycle(name string, cycle []dependency) {
+	if len(cycle) == 0 {
+		return
+	}
+	// Rotate the cycle so it starts at its smallest name. This gives every
+	// rotation of the same cycle the same description.
+	first := 0
+	for i, d := range cycle {
+		if d.name < cycle[first].name {
+			first = i
+		}
+	}
+	cycle = append(append([]dependency{}, cycle[first:]...), cycle[:first]...)
+	names := make([]string, len(cycle)+1)
+	for i, d := range cycle {
+		names[i] = d.name
+	}
+	names[len(cycle)] = cycle[0].name
+
+	related := make([]RelatedInformation, len(cycle))
+	for i, d := range cycle {
+		from := cycle[(i+len(cycle)-1)%len(cycle)].name
+		related[i] = RelatedInformation{
+			Message: "'" + from + "' references '" + d.name + "'",
+			Range:   d.location,
+		}
+	}
+	b.diags = append(b.diags, dependencyCycleDiag(name, strings.Join(names, " -> "),
+		b.variables[name].definition.DefinitionRange(), related))
+}
@@ -0,0 +1,308 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// The prefix of the type token of provider resources.
+const providerTypePrefix = "pulumi:providers:"
+
+// Check the resource options of each resource. This happens after all
+// resources are bound, since options may reference resources declared later in
+// the template.
+//
+// `retainOnDelete` and `deleteBeforeReplace` are not checked here: the parser
+// already requires them to be booleans.
+func (b *Decl) checkResourceOptions() {
+	names := make([]string, 0, len(b.variables))
+	for name := range b.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res, ok := b.variables[name].definition.(*Resource)
+		if !ok || res.defined == nil || res.defined.Value == nil || res.defined.Value.Type == nil {
+			continue
+		}
+		opts := res.defined.Value.Options
+		b.checkResourceList("dependsOn", opts.DependsOn)
+		b.checkResourceRef("parent", opts.Parent)
+		b.checkResourceRef("deletedWith", opts.DeletedWith)
+		b.checkProvider(res, opts.Provider)
+		b.checkProviders(opts.Providers)
+		b.checkProtect(opts.Protect)
+		b.checkCustomTimeouts(opts.CustomTimeouts)
+	}
+}
+
+// checkResourceList checks that `e` is a list of resources.
+func (b *Decl) checkResourceList(option string, e ast.Expr) {
+	switch e := e.(type) {
+	case nil:
+		return
+	case *ast.ListExpr:
+		for _, el := range e.Elements {
+			b.checkResourceRef(option, el)
+		}
+	default:
+		// A single expression must evaluate to a list of resources.
+		t, ok := b.knownType(e)
+		if !ok {
+			return
+		}
+		if arr, isList := UnwrapType(t).(*schema.ArrayType); isList {
+			if el := UnwrapType(arr.ElementType); el == schema.AnyType || isResourceType(el) {
+				return
+			}
+		}
+		b.diags = append(b.diags, notResourceListDiag(option, b.describeExpr(e, t), exprRange(e)))
+	}
+}
+
+// checkResourceRef checks that `e` references a resource. The resource is
+// returned if it is declared in the template.
+func (b *Decl) checkResourceRef(option string, e ast.Expr) (*Resource, string) {
+	if e == nil {
+		return nil, ""
+	}
+	if sym, ok := e.(*ast.SymbolExpr); ok && len(sym.Property.Accessors) == 1 {
+		if root, ok := sym.Property.Accessors[0].(*ast.PropertyName); ok {
+			if v, ok := b.variables[root.Name]; ok {
+				if res, ok := v.definition.(*Resource); ok {
+					return res, root.Name
+				}
+			}
+		}
+	}
+	t, ok := b.knownType(e)
+	if !ok || isResourceType(t) {
+		return nil, ""
+	}
+	b.diags = append(b.diags, notResourceDiag(option, b.describeExpr(e, t), exprRange(e)))
+	return nil, ""
+}
+
+// checkProvider checks that the `provider` option of `res` references a provider
+// resource for the package of `res`.
+func (b *Decl) checkProvider(res *Resource, e ast.Expr) {
+	provider, name := b.checkResourceRef("provider", e)
+	if provider == nil || provider.defined.Value == nil || provider.defined.Value.Type == nil {
+		return
+	}
+	providerPkg, ok := b.providerPackage(name, provider, e)
+	if !ok || strings.HasPrefix(res.token, providerTypePrefix) {
+		return
+	}
+	if res.definition != nil && res.definition.IsComponent {
+		// Components may pass their provider on to resources from any package.
+		return
+	}
+	if pkg, err := pkgNameFromToken(res.token); err == nil && pkg != providerPkg {
+		b.diags = append(b.diags, providerPackageMismatchDiag(name, providerPkg, pkg,
+			exprRange(e), provider.DefinitionRange()))
+	}
+}
+
+// checkProviders checks the `providers` option. It is either a list of provider
+// resources, or a map from package names to provider resources for that
+// package.
+func (b *Decl) checkProviders(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.ListExpr:
+		for _, el := range e.Elements {
+			if provider, name := b.checkResourceRef("providers", el); provider != nil {
+				b.providerPackage(name, provider, el)
+			}
+		}
+	case *ast.ObjectExpr:
+		for _, entry := range e.Entries {
+			key, ok := entry.Key.(*ast.StringExpr)
+			if !ok {
+				continue
+			}
+			validKey := key.Value != "" && !strings.Contains(key.Value, ":")
+			if !validKey {
+				b.diags = append(b.diags, providersKeyDiag(key.Value, exprRange(key)))
+			}
+			provider, name := b.checkResourceRef("providers", entry.Value)
+			if provider == nil {
+				continue
+			}
+			if pkg, ok := b.providerPackage(name, provider, entry.Value); ok && validKey && pkg != key.Value {
+				b.diags = append(b.diags, providerPackageMismatchDiag(name, pkg, key.Value,
+					exprRange(entry.Value), provider.DefinitionRange()))
+			}
+		}
+	default:
+		b.checkResourceList("providers", e)
+	}
+}
+
+// providerPackage returns the package that the provider resource `provider`,
+// referenced by `e`, is for. If `provider` is not a provider resource, a
+// diagnostic is reported.
+func (b *Decl) providerPackage(name string, provider *Resource, e ast.Expr) (string, bool) {
+	if provider.defined.Value == nil || provider.defined.Value.Type == nil {
+		return "", false
+	}
+	token := provider.defined.Value.Type.Value
+	if !strings.HasPrefix(token, providerTypePrefix) {
+		b.diags = append(b.diags, notProviderDiag(name, token, exprRange(e)))
+		return "", false
+	}
+	return strings.TrimPrefix(token, providerTypePrefix), true
+}
+
+// checkProtect checks that the `protect` option is a boolean.
+func (b *Decl) checkProtect(e ast.Expr) {
+	if e == nil {
+		return
+	}
+	if t, ok := b.knownType(e); ok && UnwrapType(t) != schema.BoolType {
+		b.diags = append(b.diags, protectTypeDiag(b.describeExpr(e, t), exprRange(e)))
+	}
+}
+
+// checkCustomTimeouts checks that custom timeouts are valid durations, such as
+// `10m` or `1h30m`. Unknown keys are reported by the parser.
+func (b *Decl) checkCustomTimeouts(timeouts *ast.CustomTimeoutsDecl) {
+	if timeouts == nil {
+		return
+	}
+	for _, t := range []struct {
+		name  string
+		value *ast.StringExpr
+	}{
+		{"create", timeouts.Create},
+		{"update", timeouts.Update},
+		{"delete", timeouts.Delete},
+	} {
+		if t.value == nil || t.value.Value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(t.value.Value); err != nil {
+			b.diags = append(b.diags, invalidDurationDiag(t.name, t.value.Value, exprRange(t.value)))
+		}
+	}
+}
+
+// knownType returns the type of `e`, if it is known without a schema.
+func (b *Decl) knownType(e ast.Expr) (schema.Type, bool) {
+	if sym, ok := e.(*ast.SymbolExpr); ok {
+		root, ok := sym.Property.Accessors[0].(*ast.PropertyName)
+		if !ok {
+			return nil, false
+		}
+		// Missing variables are reported elsewhere.
+		if v, ok := b.variables[root.Name]; !ok || v.definition == nil {
+			return nil, false
+		}
+	}
+	t := b.typeExpr(e)
+	if t == nil || UnwrapType(t) == schema.AnyType {
+		return nil, false
+	}
+	return t, true
+}
+
+// describeExpr describes what `e` is, for use in diagnostics.
+func (b *Decl) describeExpr(e ast.Expr, t schema.Type) string {
+	if sym, ok := e.(*ast.SymbolExpr); ok && len(sym.Property.Accessors) == 1 {
+		if root, ok := sym.Property.Accessors[0].(*ast.PropertyName); ok {
+			switch b.variables[root.Name].definition.(type) {
+			case *ConfigMapEntry:
+				return fmt.Sprintf("configuration value '%s' of type %s", root.Name, diags.DisplayType(t))
+			case *VariableMapEntry:
+				return fmt.Sprintf("variable '%s' of type %s", root.Name, diags.DisplayType(t))
+			}
+		}
+	}
+	return fmt.Sprintf("a value of type %s", diags.DisplayType(t))
+}
+
+func isResourceType(t schema.Type) bool {
+	_, ok := UnwrapType(t).(*schema.ResourceType)
+	return ok
+}
+
+func exprRange(e ast.Expr) *hcl.Range {
+	if s := e.Syntax(); s != nil && s.Syntax() != nil {
+		return s.Syntax().Range()
+	}
+	return nil
+}
+
+// ParsePropertyPath parses a property path, such as `a.b[0].c`, as used by the
+// `ignoreChanges`, `replaceOnChanges` and `additionalSecretOutputs` resource
+// options. Each accessor is located at `loc`.
+func ParsePropertyPath(path string, loc *hcl.Range) (PropertyAccessorList, bool) {
+	e, diags := ast.ParseExpr(syntax.String("${" + path + "}"))
+	if diags.HasErrors() {
+		return nil, false
+	}
+	sym, ok := e.(*ast.SymbolExpr)
+	if !ok {
+		return nil, false
+	}
+	l := make(PropertyAccessorList, len(sym.Property.Accessors))
+	for i, a := range sym.Property.Accessors {
+		l[i] = PropertyAccessor{PropertyAccessor: a, rnge: loc}
+	}
+	return l, true
+}
+
+// PropertyPathRoot returns the type that the property paths of a resource
+// option are relative to: the resource's outputs for `additionalSecretOutputs`,
+// and its inputs otherwise.
+func PropertyPathRoot(option string, r *schema.Resource) schema.Type {
+	props := r.InputProperties
+	if strings.EqualFold(option, "additionalSecretOutputs") {
+		props = r.Properties
+	}
+	return &schema.ObjectType{Token: r.Token, Properties: props}
+}
+
+// Check that the property paths given to the options of a resource exist on
+// the resource.
+func (b *Decl) validatePropertyPaths(r *ast.ResourcesMapEntry, res *schema.Resource) {
+	opts := r.Value.Options
+	for _, o := range []struct {
+		name  string
+		paths *ast.StringListDecl
+	}{
+		{"ignoreChanges", opts.IgnoreChanges},
+		{"replaceOnChanges", opts.ReplaceOnChanges},
+		{"additionalSecretOutputs", opts.AdditionalSecretOutputs},
+	} {
+		if o.paths == nil {
+			continue
+		}
+		root := PropertyPathRoot(o.name, res)
+		for _, path := range o.paths.Elements {
+			if strings.Contains(path.Value, "*") {
+				// Wildcards match any property.
+				continue
+			}
+			loc := exprRange(path)
+			accessors, ok := ParsePropertyPath(path.Value, loc)
+			if !ok {
+				b.diags = append(b.diags, invalidPropertyPathDiag(path.Value, loc))
+				continue
+			}
+			if _, diag := accessors.TypeFromRoot(root); diag != nil {
+				b.diags = append(b.diags, diag)
+			}
+		}
+	}
+}
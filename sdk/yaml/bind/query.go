@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
 
 	"github.com/pulumi/pulumi-lsp/sdk/util"
 )
@@ -50,6 +51,18 @@ func (d *Decl) Invokes() []Invoke {
 	return util.DerefList(util.MapKeys(d.invokes))
 }
 
+// LookupInvoke returns the invoke defined by `expr`. Its schema is filled in once
+// the template's schemas are loaded.
+func (d *Decl) LookupInvoke(expr *ast.InvokeExpr) (Invoke, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	invoke, ok := d.invokeExprs[expr]
+	if !ok {
+		return Invoke{}, false
+	}
+	return *invoke, true
+}
+
 // Retrieve the diagnostic list for the Decl.
 func (b *Decl) Diags() hcl.Diagnostics {
 	if b == nil {
@@ -71,3 +84,12 @@ func (d *Decl) References() []Reference {
 func (d *Decl) Variables() map[string]*Variable {
 	return d.variables
 }
+
+// FilePaths returns the paths passed to `fn::readFile`, `fn::fileAsset` and
+// `fn::fileArchive`.
+func (d *Decl) FilePaths() []FilePath {
+	if d == nil {
+		return nil
+	}
+	return d.filePaths
+}
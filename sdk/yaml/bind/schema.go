@@ -3,7 +3,9 @@
 package bind
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/blang/semver"
@@ -15,18 +17,25 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
 
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
 	"github.com/pulumi/pulumi-lsp/sdk/util"
 )
 
 // Loads schemas as necessary from the loader to attach to resources and invokes.
 // The schemas are cached internally to make searching faster.
 // New diagnostics are appended to the internal diag list.
-func (d *Decl) LoadSchema(loader schema.ReferenceLoader) {
+//
+// Loading stops early if `ctx` is canceled, leaving the Decl partially typed.
+func (d *Decl) LoadSchema(ctx context.Context, loader schema.ReferenceLoader) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	d.preloadPackages(ctx, loader)
 	for invoke := range d.invokes {
+		if ctx.Err() != nil {
+			return
+		}
 		typeLoc := invoke.defined.Token.Syntax().Syntax().Range()
-		pkgName := d.loadPackage(invoke.token, invoke.version, loader,
+		pkgName := d.loadPackage(ctx, invoke.token, invoke.version, loader,
 			invoke.defined.Token.Syntax().Syntax().Range())
 		if pkgName != "" {
 			pkg := d.loadedPackages[pkgKey{pkgName, invoke.version}]
@@ -83,13 +92,16 @@ func (d *Decl) LoadSchema(loader schema.ReferenceLoader) {
 	}
 
 	for _, v := range d.variables {
+		if ctx.Err() != nil {
+			return
+		}
 		if v, ok := v.definition.(*Resource); ok {
 			if v.defined.Value == nil || v.defined.Value.Type == nil {
 				// Type is not defined, so exit early
 				continue
 			}
 			typeLoc := v.defined.Value.Type.Syntax().Syntax().Range()
-			pkgName := d.loadPackage(v.token, v.version, loader, typeLoc)
+			pkgName := d.loadPackage(ctx, v.token, v.version, loader, typeLoc)
 			if pkgName != "" {
 				pkg := d.loadedPackages[pkgKey{pkgName, v.version}]
 				if pkg.diag != nil {
@@ -105,13 +117,23 @@ func (d *Decl) LoadSchema(loader schema.ReferenceLoader) {
 						d.diags = d.diags.Extend(f.diag(typeLoc))
 					}
 					v.definition = f.Resource
-					d.validateProperties(util.MapOver(v.defined.Value.Properties.Entries, func(m ast.PropertyMapEntry) MapKey {
-						return MapKey{m.Key.Value, m.Key.Syntax().Syntax().Range()}
-					}),
-						f.InputProperties, (&schema.ResourceType{
-							Token:    f.Resource.Token,
-							Resource: f.Resource,
-						}).String(), v.defined.Key.Syntax().Syntax().Range())
+					resourceType := (&schema.ResourceType{
+						Token:    f.Resource.Token,
+						Resource: f.Resource,
+					}).String()
+					if isRead(v.defined.Value) {
+						// A read resource is found by its state instead of
+						// being created from its inputs.
+						get := v.defined.Value.Get
+						d.validateProperties(util.MapOver(get.State.Entries, func(m ast.PropertyMapEntry) MapKey {
+							return MapKey{m.Key.Value, m.Key.Syntax().Syntax().Range()}
+						}), StateProperties(f.Resource), resourceType, get.Syntax().Syntax().Range())
+					} else {
+						d.validateProperties(util.MapOver(v.defined.Value.Properties.Entries, func(m ast.PropertyMapEntry) MapKey {
+							return MapKey{m.Key.Value, m.Key.Syntax().Syntax().Range()}
+						}), f.InputProperties, resourceType, v.defined.Key.Syntax().Syntax().Range())
+					}
+					d.validatePropertyPaths(v.defined, f.Resource)
 				} else {
 					d.diags = append(d.diags, missingTokenDiag(pkgName, v.token, typeLoc))
 				}
@@ -119,7 +141,159 @@ func (d *Decl) LoadSchema(loader schema.ReferenceLoader) {
 		}
 	}
 
+	d.inferTypes()
 	d.checkSchemaPropertyAccesses()
+	d.checkExprTypes()
+	d.checkSecrets()
+}
+
+// StateProperties returns the properties that can be given as `get.state` when
+// reading a resource. They are the resource's state inputs, or its outputs if it
+// doesn't declare state inputs. None of them are required.
+func StateProperties(r *schema.Resource) []*schema.Property {
+	props := r.Properties
+	if r.StateInputs != nil {
+		props = r.StateInputs.Properties
+	}
+	state := make([]*schema.Property, 0, len(props))
+	for _, p := range props {
+		if p == nil {
+			continue
+		}
+		p := *p
+		if p.IsRequired() {
+			p.Type = &schema.OptionalType{ElementType: p.Type}
+		}
+		state = append(state, &p)
+	}
+	return state
+}
+
+// The subset of loader.ReferenceLoader that reports which packages have already
+// been loaded.
+type loadedReporter interface {
+	Loaded() []schema.PackageDescriptor
+}
+
+// A token that requires loading a package, and where it was found.
+type packageRequest struct {
+	token string
+	loc   *hcl.Range
+}
+
+// referencedPackages finds the packages referenced by resources and invokes in
+// the template. Unparsable tokens are skipped. Calling referencedPackages
+// requires holding `d.lock`.
+func (d *Decl) referencedPackages() map[pkgKey]packageRequest {
+	requests := map[pkgKey]packageRequest{}
+	add := func(tk, version string, loc *hcl.Range) {
+		pkgName, err := pkgNameFromToken(tk)
+		if err != nil {
+			return
+		}
+		key := pkgKey{pkgName, version}
+		if _, ok := requests[key]; !ok {
+			requests[key] = packageRequest{tk, loc}
+		}
+	}
+	for invoke := range d.invokes {
+		add(invoke.token, invoke.version, invoke.defined.Token.Syntax().Syntax().Range())
+	}
+	for _, v := range d.variables {
+		if r, ok := v.definition.(*Resource); ok && r.defined.Value != nil && r.defined.Value.Type != nil {
+			add(r.token, r.version, r.defined.Value.Type.Syntax().Syntax().Range())
+		}
+	}
+	return requests
+}
+
+// sortedKeys returns the keys of `m`, ordered by name and then version.
+func sortedKeys[T any](m map[pkgKey]T) []pkgKey {
+	keys := util.MapKeys(m)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name == keys[j].name {
+			return keys[i].version < keys[j].version
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+// Packages returns the packages referenced by resources and invokes in the
+// template, without loading them. Packages with an invalid version are
+// omitted.
+func (d *Decl) Packages() []schema.PackageDescriptor {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	var packages []schema.PackageDescriptor
+	for _, key := range sortedKeys(d.referencedPackages()) {
+		desc := schema.PackageDescriptor{Name: key.name}
+		if key.version != "" {
+			v, err := semver.ParseTolerant(key.version)
+			if err != nil {
+				continue
+			}
+			desc.Version = &v
+		}
+		packages = append(packages, desc)
+	}
+	return packages
+}
+
+// Load every package referenced by resources and invokes in the template into
+// the package cache.
+//
+// If the loader needs to load new packages, progress is reported to the client
+// attached to `ctx` (if any). The progress is attached to the context of each
+// load, so the loader doesn't report each package separately. Unparsable tokens
+// are skipped, since they are reported when the individual resource or invoke
+// is checked.
+func (d *Decl) preloadPackages(ctx context.Context, loader schema.ReferenceLoader) {
+	requests := d.referencedPackages()
+	keys := sortedKeys(requests)
+
+	var progress *lsp.Progress
+	if client, ok := lsp.ClientFromContext(ctx); ok && needsLoad(loader, keys) {
+		p, err := client.BeginProgress("Loading schemas", fmt.Sprintf("Loading %d packages", len(keys)))
+		contract.IgnoreError(err)
+		progress = p
+		defer func() { contract.IgnoreError(progress.End("")) }()
+		ctx = lsp.WithProgress(ctx, progress)
+	}
+
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		contract.IgnoreError(progress.Report(
+			fmt.Sprintf("Loading schema %s (%d/%d)", key, i+1, len(keys)),
+			uint32(i*100/len(keys))))
+		d.loadPackage(ctx, requests[key].token, key.version, loader, requests[key].loc)
+	}
+}
+
+// needsLoad checks if any package in `keys` has not already been loaded by
+// `loader`. If the loader does not track loaded packages, it is assumed that
+// all packages need to be loaded.
+func needsLoad(loader schema.ReferenceLoader, keys []pkgKey) bool {
+	l, ok := loader.(loadedReporter)
+	if !ok {
+		return len(keys) > 0
+	}
+	loaded := map[pkgKey]bool{}
+	for _, desc := range l.Loaded() {
+		key := pkgKey{name: desc.Name}
+		if desc.Version != nil {
+			key.version = desc.Version.String()
+		}
+		loaded[key] = true
+	}
+	for _, key := range keys {
+		if !loaded[key] {
+			return true
+		}
+	}
+	return false
 }
 
 type MapKey struct {
@@ -135,9 +309,9 @@ func (d *Decl) validateProperties(existing []MapKey, typed []*schema.Property, p
 	for _, prop := range existing {
 		definedProps[prop.tag] = true
 	}
-	resourceProps := map[string]bool{}
+	resourceProps := map[string]*schema.Property{}
 	for _, prop := range typed {
-		resourceProps[prop.Name] = true
+		resourceProps[prop.Name] = prop
 		if prop.IsRequired() && !definedProps[prop.Name] {
 			// TODO: it would be good to put the error message on the
 			// properties tag, but that is not available.
@@ -145,111 +319,16 @@ func (d *Decl) validateProperties(existing []MapKey, typed []*schema.Property, p
 		}
 	}
 	for _, prop := range existing {
-		if !resourceProps[prop.tag] {
+		typed, ok := resourceProps[prop.tag]
+		if !ok {
 			d.diags = append(d.diags, propertyDoesNotExistDiag(prop.tag,
 				parent, util.MapKeys(resourceProps), prop.rnge))
+		} else if typed.DeprecationMessage != "" {
+			d.diags = append(d.diags, depreciatedDiag(prop.tag, typed.DeprecationMessage, prop.rnge))
 		}
 	}
 }
 
-func (d *Decl) typeExpr(e ast.Expr) schema.Type {
-	switch e := e.(type) {
-	// Primitive types: nothing to bind
-	case *ast.NullExpr:
-		return nil
-	case *ast.BooleanExpr:
-		return schema.BoolType
-	case *ast.NumberExpr:
-		return schema.NumberType
-	case *ast.StringExpr, *ast.InterpolateExpr:
-		return schema.StringType
-
-	case *ast.SymbolExpr:
-		var tag string
-		if t, ok := e.Property.Accessors[0].(*ast.PropertyName); ok {
-			tag = t.Name
-		}
-		if v, ok := d.variables[tag]; tag != "" && ok {
-			t := v.definition.ResolveType(d)
-			if len(e.Property.Accessors) == 0 {
-				return t
-			}
-			for _, r := range v.uses {
-				if r.location == e.Syntax().Syntax().Range() {
-					types, _ := r.access.TypeFromRoot(t)
-					return types[len(types)-1]
-				}
-			}
-		}
-		return nil
-
-	// Container types:
-	case *ast.ListExpr:
-		t := schema.AnyType
-		if len(e.Elements) != 0 {
-			t = d.typeExpr(e.Elements[0])
-		}
-		return &schema.ArrayType{ElementType: t}
-
-	case *ast.ObjectExpr:
-		// TODO handle object types
-		return nil
-
-	case *ast.InvokeExpr:
-		t := e.Token
-		if t == nil {
-			return nil
-		}
-		for invoke := range d.invokes {
-			if invoke.token == t.Value {
-				if invoke.definition != nil {
-					outputs := invoke.definition.Outputs
-					if e.Return != nil {
-						p, ok := outputs.Property(e.Return.Value)
-						if ok {
-							return p.Type
-						}
-						return nil
-					}
-					return outputs
-				}
-				break
-			}
-		}
-		return nil
-
-	case *ast.AssetArchiveExpr, *ast.FileArchiveExpr, *ast.RemoteArchiveExpr:
-		return schema.ArchiveType
-	case *ast.FileAssetExpr, *ast.RemoteAssetExpr, *ast.StringAssetExpr:
-		return schema.AssetType
-
-	// Stack reference
-	case *ast.StackReferenceExpr:
-		return nil
-
-	// Functions
-	case *ast.JoinExpr:
-		return schema.StringType
-	case *ast.SelectExpr:
-		el := d.typeExpr(e.Values)
-		if el == nil {
-			return nil
-		}
-		if e, ok := el.(*schema.ArrayType); ok {
-			return e.ElementType
-		}
-		return nil
-	case *ast.SplitExpr:
-		return schema.StringType
-	case *ast.ToBase64Expr:
-		return schema.StringType
-	case *ast.ToJSONExpr:
-		return schema.StringType
-	default:
-		return nil
-	}
-}
-
 // We have resolved variables and invokes to their schema equivalents. We can
 // now resolve property access, posting diagnostics as necessary.
 func (d *Decl) checkSchemaPropertyAccesses() {
@@ -301,7 +380,9 @@ func (d *Decl) verifyPropertyAccess(expr PropertyAccessorList, typ schema.Type)
 
 // Load a package into the cache if necessary. errRange is the location that
 // motivated loading the package (a type token in a invoke or a resource).
-func (d *Decl) loadPackage(tk, version string, loader schema.ReferenceLoader, errRange *hcl.Range) string {
+func (d *Decl) loadPackage(
+	ctx context.Context, tk, version string, loader schema.ReferenceLoader, errRange *hcl.Range,
+) string {
 	pkgName, err := pkgNameFromToken(tk)
 	if err != nil {
 		d.diags = append(d.diags, unparsableTokenDiag(tk, errRange, err))
@@ -319,7 +400,7 @@ func (d *Decl) loadPackage(tk, version string, loader schema.ReferenceLoader, er
 			}
 			v = &version
 		}
-		p, err := loader.LoadPackageReference(pkgName, v)
+		p, err := loader.LoadPackageReferenceV2(ctx, &schema.PackageDescriptor{Name: pkgName, Version: v})
 		var pkg pkgCache
 		if err != nil {
 			pkg = pkgCache{
@@ -0,0 +1,236 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// PlaintextSecret describes a value that should be secret, but is not. It is
+// attached to secret diagnostics so that editors can offer to fix them.
+type PlaintextSecret struct {
+	// The key the value is assigned to, or nil if the value is a list element.
+	Key ast.Expr
+	// The value that should be secret.
+	Value ast.Expr
+
+	// The name of a new configuration entry to hold the value, and the type of
+	// that entry. ConfigName is empty if the value can't be moved into
+	// configuration.
+	ConfigName string
+	ConfigType string
+}
+
+// Check that secrets are not exposed in plaintext: secret properties should not
+// be assigned literal values, and outputs that reference secrets should be
+// wrapped in `fn::secret`.
+//
+// This runs after the schema is loaded, since secrecy comes from the schema.
+func (d *Decl) checkSecrets() {
+	names := make([]string, 0, len(d.variables))
+	for name := range d.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res, ok := d.variables[name].definition.(*Resource)
+		if !ok || res.definition == nil || res.defined.Value == nil || isRead(res.defined.Value) {
+			continue
+		}
+		for _, entry := range res.defined.Value.Properties.Entries {
+			if prop, ok := findSchemaProperty(res.definition.InputProperties, entry.Key.Value); ok {
+				d.checkPlaintextSecret(name, entry.Key, prop.Name, prop.Type, prop.Secret, entry.Value)
+			}
+		}
+	}
+
+	outputs := make([]string, 0, len(d.outputs))
+	for name := range d.outputs {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+	for _, name := range outputs {
+		o := d.outputs[name]
+		if secret, ok := d.exposedSecret(o.Value); ok {
+			d.diags = append(d.diags, exposedSecretOutputDiag(name, secret, exprRange(o.Value),
+				PlaintextSecret{Key: o.Key, Value: o.Value}))
+		}
+	}
+}
+
+// checkPlaintextSecret reports literal values assigned to secret properties of
+// the resource `resource`. `value` is assigned to `key`, which names a property
+// of type `typ`.
+func (d *Decl) checkPlaintextSecret(resource string, key ast.Expr, name string, typ schema.Type, secret bool, value ast.Expr) {
+	if secret {
+		if configType, ok := literalConfigType(value); ok {
+			d.diags = append(d.diags, plaintextSecretDiag(name, resource, exprRange(value), PlaintextSecret{
+				Key:        key,
+				Value:      value,
+				ConfigName: d.newConfigName(resource + strings.ToUpper(name[:1]) + name[1:]),
+				ConfigType: configType,
+			}))
+		}
+		return
+	}
+	switch typ := UnwrapType(typ).(type) {
+	case *schema.ObjectType:
+		o, ok := value.(*ast.ObjectExpr)
+		if !ok {
+			return
+		}
+		for _, entry := range o.Entries {
+			k, ok := entry.Key.(*ast.StringExpr)
+			if !ok {
+				continue
+			}
+			if prop, ok := typ.Property(k.Value); ok {
+				d.checkPlaintextSecret(resource, k, prop.Name, prop.Type, prop.Secret, entry.Value)
+			}
+		}
+	case *schema.ArrayType:
+		l, ok := value.(*ast.ListExpr)
+		if !ok {
+			return
+		}
+		for _, el := range l.Elements {
+			d.checkPlaintextSecret(resource, nil, name, typ.ElementType, false, el)
+		}
+	case *schema.MapType:
+		o, ok := value.(*ast.ObjectExpr)
+		if !ok {
+			return
+		}
+		for _, entry := range o.Entries {
+			d.checkPlaintextSecret(resource, entry.Key, name, typ.ElementType, false, entry.Value)
+		}
+	}
+}
+
+// exposedSecret finds a secret referenced by `e` outside of `fn::secret`,
+// returning a description of it.
+func (d *Decl) exposedSecret(e ast.Expr) (string, bool) {
+	var exprs []ast.Expr
+	switch e := e.(type) {
+	case *ast.SymbolExpr:
+		return d.secretAccess(e.Property)
+	case *ast.InterpolateExpr:
+		for _, part := range e.Parts {
+			if part.Value == nil {
+				continue
+			}
+			if secret, ok := d.secretAccess(part.Value); ok {
+				return secret, true
+			}
+		}
+	case *ast.ListExpr:
+		exprs = e.Elements
+	case *ast.ObjectExpr:
+		for _, entry := range e.Entries {
+			exprs = append(exprs, entry.Value)
+		}
+	case *ast.JoinExpr:
+		exprs = []ast.Expr{e.Delimiter, e.Values}
+	case *ast.SelectExpr:
+		exprs = []ast.Expr{e.Values}
+	case *ast.SplitExpr:
+		exprs = []ast.Expr{e.Source}
+	case *ast.ToBase64Expr:
+		exprs = []ast.Expr{e.Value}
+	case *ast.ToJSONExpr:
+		exprs = []ast.Expr{e.Value}
+	}
+	for _, e := range exprs {
+		if secret, ok := d.exposedSecret(e); ok {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+// secretAccess checks if the property access `p` reads a secret: a secret
+// configuration value, a variable wrapped in `fn::secret` or a secret output of
+// a resource.
+func (d *Decl) secretAccess(p *ast.PropertyAccess) (string, bool) {
+	if p == nil || len(p.Accessors) == 0 {
+		return "", false
+	}
+	root, ok := p.Accessors[0].(*ast.PropertyName)
+	if !ok {
+		return "", false
+	}
+	v, ok := d.variables[root.Name]
+	if !ok {
+		return "", false
+	}
+	switch def := v.definition.(type) {
+	case *ConfigMapEntry:
+		if def.IsSecret() {
+			return fmt.Sprintf("the secret configuration value '%s'", root.Name), true
+		}
+	case *VariableMapEntry:
+		if _, ok := def.Value.(*ast.SecretExpr); ok {
+			return fmt.Sprintf("the secret variable '%s'", root.Name), true
+		}
+	case *Resource:
+		if def.definition == nil || len(p.Accessors) < 2 {
+			return "", false
+		}
+		name, ok := p.Accessors[1].(*ast.PropertyName)
+		if !ok {
+			return "", false
+		}
+		secret := false
+		if prop, ok := findSchemaProperty(def.definition.Properties, name.Name); ok {
+			secret = prop.Secret
+		}
+		if opts := def.defined.Value.Options.AdditionalSecretOutputs; opts != nil {
+			for _, o := range opts.Elements {
+				secret = secret || o.Value == name.Name
+			}
+		}
+		if secret {
+			return fmt.Sprintf("the secret property '%s' of '%s'", name.Name, root.Name), true
+		}
+	}
+	return "", false
+}
+
+// newConfigName returns a name for a new configuration entry, based on `name`,
+// that doesn't conflict with any existing name.
+func (d *Decl) newConfigName(name string) string {
+	candidate := name
+	for i := 2; ; i++ {
+		if _, ok := d.variables[candidate]; !ok {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+}
+
+// The configuration type that holds the literal `e`.
+func literalConfigType(e ast.Expr) (string, bool) {
+	switch e.(type) {
+	case *ast.StringExpr:
+		return "String", true
+	case *ast.NumberExpr:
+		return "Number", true
+	case *ast.BooleanExpr:
+		return "Boolean", true
+	}
+	return "", false
+}
+
+func findSchemaProperty(props []*schema.Property, name string) (*schema.Property, bool) {
+	for _, p := range props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
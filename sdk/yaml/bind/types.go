@@ -0,0 +1,509 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi-lsp/sdk/util"
+)
+
+// Infer the type of every expression in the template, caching the results.
+//
+// Types depend on the schemas of resources and invokes, so they are inferred
+// again once schemas are loaded. Until inference finishes, types are computed
+// without the cache.
+func (d *Decl) inferTypes() {
+	d.typesLock.Lock()
+	d.exprTypes, d.pendingTypes = nil, map[ast.Expr]schema.Type{}
+	d.typesLock.Unlock()
+
+	d.walkExprs(func(e ast.Expr) { d.typeExpr(e) })
+
+	// The cache is swapped in whole, so readers never see it half built.
+	d.typesLock.Lock()
+	d.exprTypes, d.pendingTypes = d.pendingTypes, nil
+	d.typesLock.Unlock()
+}
+
+// typeExpr returns the type of `e`, or nil if the type is unknown.
+//
+// Types are read while hovering and completing, without holding the Decl's
+// lock, so the cache has a lock of its own.
+func (d *Decl) typeExpr(e ast.Expr) schema.Type {
+	d.typesLock.Lock()
+	t, ok := d.exprTypes[e]
+	if !ok {
+		t, ok = d.pendingTypes[e]
+	}
+	d.typesLock.Unlock()
+	if ok {
+		return t
+	}
+
+	t = d.inferExpr(e)
+	d.typesLock.Lock()
+	if d.pendingTypes != nil {
+		d.pendingTypes[e] = t
+	}
+	d.typesLock.Unlock()
+	return t
+}
+
+func (d *Decl) inferExpr(e ast.Expr) schema.Type {
+	switch e := e.(type) {
+	// Primitive types
+	case *ast.NullExpr:
+		return nil
+	case *ast.BooleanExpr:
+		return schema.BoolType
+	case *ast.NumberExpr:
+		return schema.NumberType
+	case *ast.StringExpr, *ast.InterpolateExpr:
+		return schema.StringType
+
+	case *ast.SymbolExpr:
+		return d.accessType(e.Property)
+
+	// Container types
+	case *ast.ListExpr:
+		elements := make([]schema.Type, len(e.Elements))
+		for i, el := range e.Elements {
+			elements[i] = d.typeExpr(el)
+		}
+		return &schema.ArrayType{ElementType: unionOf(elements)}
+
+	case *ast.ObjectExpr:
+		// Object literals have a structural type, without a token.
+		t := &schema.ObjectType{}
+		seen := map[string]bool{}
+		for _, entry := range e.Entries {
+			k, ok := entry.Key.(*ast.StringExpr)
+			if !ok || seen[k.Value] {
+				// Computed keys are only known when the program runs, and
+				// duplicate keys are reported when binding.
+				continue
+			}
+			seen[k.Value] = true
+			typ := d.typeExpr(entry.Value)
+			if typ == nil {
+				typ = schema.AnyType
+			}
+			t.Properties = append(t.Properties, &schema.Property{Name: k.Value, Type: typ})
+		}
+		return t
+
+	case *ast.InvokeExpr:
+		if e.Token == nil {
+			return nil
+		}
+		invoke, ok := d.invokeExprs[e]
+		if !ok || invoke.definition == nil || invoke.definition.Outputs == nil {
+			return nil
+		}
+		outputs := invoke.definition.Outputs
+		if e.Return != nil {
+			p, ok := outputs.Property(e.Return.Value)
+			if ok {
+				return p.Type
+			}
+			return nil
+		}
+		return outputs
+
+	case *ast.AssetArchiveExpr, *ast.FileArchiveExpr, *ast.RemoteArchiveExpr:
+		return schema.ArchiveType
+	case *ast.FileAssetExpr, *ast.RemoteAssetExpr, *ast.StringAssetExpr:
+		return schema.AssetType
+	case *ast.ReadFileExpr:
+		return schema.StringType
+
+	// Secrets are marked, so hover and completion can show them.
+	case *ast.SecretExpr:
+		return secret(d.typeExpr(e.Value))
+
+	// Stack outputs can have any type.
+	case *ast.StackReferenceExpr:
+		return schema.AnyType
+
+	// Functions
+	case *ast.JoinExpr, *ast.ToBase64Expr, *ast.FromBase64Expr, *ast.ToJSONExpr:
+		return schema.StringType
+	case *ast.SplitExpr:
+		return &schema.ArrayType{ElementType: schema.StringType}
+	case *ast.SelectExpr:
+		el, _ := elementType(d.typeExpr(e.Values))
+		return el
+	default:
+		return nil
+	}
+}
+
+// accessType returns the type of the value read by `p`, or nil if it is
+// unknown.
+func (d *Decl) accessType(p *ast.PropertyAccess) schema.Type {
+	if p == nil || len(p.Accessors) == 0 {
+		return nil
+	}
+	root, ok := p.Accessors[0].(*ast.PropertyName)
+	if !ok {
+		return nil
+	}
+	v, ok := d.variables[root.Name]
+	if !ok || v.definition == nil || d.cyclic[root.Name] {
+		return nil
+	}
+	t := v.definition.ResolveType(d)
+	if t == nil {
+		return nil
+	}
+	accessors := make(PropertyAccessorList, len(p.Accessors)-1)
+	for i, a := range p.Accessors[1:] {
+		accessors[i] = PropertyAccessor{PropertyAccessor: a}
+	}
+	types, diag := accessors.TypeFromRoot(t)
+	if diag != nil || len(types) != len(accessors)+1 {
+		// The type of the accessed property is unknown.
+		return nil
+	}
+	typ := resolvedType(types[len(types)-1])
+
+	// Anything read from a secret is secret, as is a secret property.
+	isSecret := false
+	if config, ok := v.definition.(*ConfigMapEntry); ok && config.IsSecret() {
+		isSecret = true
+	}
+	for _, t := range types {
+		isSecret = isSecret || IsSecret(t)
+	}
+	if prop, ok := accessors.PropertyFromRoot(t); ok && prop.Secret {
+		isSecret = true
+	}
+	if isSecret {
+		return secret(typ)
+	}
+	return typ
+}
+
+// SecretType is the type of a secret value, such as the value of `fn::secret`
+// or a secret property. It wraps the type of the value it hides.
+type SecretType struct {
+	// The type of the hidden value. Embedding it makes SecretType a
+	// schema.Type.
+	schema.Type
+}
+
+func (t *SecretType) String() string {
+	return fmt.Sprintf("Secret<%s>", diags.DisplayType(t.Type))
+}
+
+// secret marks `t` as secret. Secrets of an unknown type can hold anything.
+func secret(t schema.Type) schema.Type {
+	if t == nil {
+		t = schema.AnyType
+	}
+	if IsSecret(t) {
+		return t
+	}
+	return &SecretType{Type: t}
+}
+
+// IsSecret checks if values of type `t` are secret.
+func IsSecret(t schema.Type) bool {
+	for {
+		switch typ := t.(type) {
+		case *SecretType:
+			return true
+		case *schema.InputType:
+			t = typ.ElementType
+		case *schema.OptionalType:
+			t = typ.ElementType
+		default:
+			return false
+		}
+	}
+}
+
+// UnwrapType returns the type of the values held by `t`, looking through
+// secret, input and optional wrappers.
+//
+// Unlike codegen.UnwrapType, secrets are unwrapped too: a secret can be used
+// wherever the value it hides can.
+func UnwrapType(t schema.Type) schema.Type {
+	for {
+		switch typ := t.(type) {
+		case *SecretType:
+			t = typ.Type
+		case *schema.InputType:
+			t = typ.ElementType
+		case *schema.OptionalType:
+			t = typ.ElementType
+		default:
+			return t
+		}
+	}
+}
+
+// resolvedType drops the input wrappers of `t`, and replaces the input shapes
+// of object types with their plain shapes. A template reads values once they
+// are resolved, so inputs don't describe the values it sees. Outputs have no
+// wrapper in a schema, so their types are already resolved. Optional and
+// secret wrappers are kept.
+func resolvedType(t schema.Type) schema.Type {
+	switch typ := t.(type) {
+	case *schema.InputType:
+		return resolvedType(typ.ElementType)
+	case *schema.OptionalType:
+		if el := resolvedType(typ.ElementType); el != typ.ElementType {
+			return &schema.OptionalType{ElementType: el}
+		}
+	case *SecretType:
+		if el := resolvedType(typ.Type); el != typ.Type {
+			return &SecretType{Type: el}
+		}
+	case *schema.ArrayType:
+		if el := resolvedType(typ.ElementType); el != typ.ElementType {
+			return &schema.ArrayType{ElementType: el}
+		}
+	case *schema.MapType:
+		if el := resolvedType(typ.ElementType); el != typ.ElementType {
+			return &schema.MapType{ElementType: el}
+		}
+	case *schema.UnionType:
+		elements := make([]schema.Type, len(typ.ElementTypes))
+		changed := false
+		for i, el := range typ.ElementTypes {
+			elements[i] = resolvedType(el)
+			changed = changed || elements[i] != el
+		}
+		if changed {
+			return &schema.UnionType{ElementTypes: elements, DefaultType: typ.DefaultType,
+				Discriminator: typ.Discriminator, Mapping: typ.Mapping}
+		}
+	case *schema.ObjectType:
+		if typ.PlainShape != nil {
+			return typ.PlainShape
+		}
+	}
+	return t
+}
+
+// elementType returns the type of the elements of the list type `t`. Input and
+// optional wrappers are looked through, and the elements of a union are the
+// union of the elements of its list members. It fails if `t` can't be a list.
+func elementType(t schema.Type) (schema.Type, bool) {
+	switch t := UnwrapType(t).(type) {
+	case nil:
+		return nil, true
+	case *schema.ArrayType:
+		return t.ElementType, true
+	case *schema.UnionType:
+		var elements []schema.Type
+		for _, member := range t.ElementTypes {
+			if el, ok := elementType(member); ok {
+				elements = append(elements, el)
+			}
+		}
+		if len(elements) == 0 {
+			return nil, false
+		}
+		return unionOf(elements), true
+	default:
+		if t == schema.AnyType || t == schema.JSONType {
+			return schema.AnyType, true
+		}
+		return nil, false
+	}
+}
+
+// unionOf returns a type that can hold a value of any of `types`. Unknown types
+// are treated as `any`.
+func unionOf(types []schema.Type) schema.Type {
+	if len(types) == 0 {
+		return schema.AnyType
+	}
+	distinct := map[string]schema.Type{}
+	for _, t := range types {
+		if t == nil || UnwrapType(t) == schema.AnyType {
+			return schema.AnyType
+		}
+		distinct[diags.DisplayType(t)] = t
+	}
+	if len(distinct) == 1 {
+		return types[0]
+	}
+	keys := util.MapKeys(distinct)
+	sort.Strings(keys)
+	union := &schema.UnionType{}
+	for _, k := range keys {
+		union.ElementTypes = append(union.ElementTypes, distinct[k])
+	}
+	return union
+}
+
+// isStructured checks if every value of type `t` is a list, map, object,
+// resource, asset or archive: a value that can't be used where a string is
+// expected. Unknown types are not structured.
+func isStructured(t schema.Type) bool {
+	switch t := UnwrapType(t).(type) {
+	case nil:
+		return false
+	case *schema.ArrayType, *schema.MapType, *schema.ObjectType, *schema.ResourceType:
+		return true
+	case *schema.UnionType:
+		for _, member := range t.ElementTypes {
+			if !isStructured(member) {
+				return false
+			}
+		}
+		return len(t.ElementTypes) > 0
+	default:
+		return t == schema.AssetType || t == schema.ArchiveType
+	}
+}
+
+// Check that builtins and interpolations are given values of the right type.
+func (d *Decl) checkExprTypes() {
+	d.walkExprs(func(e ast.Expr) {
+		switch e := e.(type) {
+		case *ast.InterpolateExpr:
+			for _, part := range e.Parts {
+				if part.Value == nil {
+					continue
+				}
+				if t := d.accessType(part.Value); isStructured(t) {
+					d.diags = append(d.diags, structuredInterpolationDiag(part.Value.String(), t, exprRange(e)))
+				}
+			}
+		case *ast.SelectExpr:
+			d.checkListArgument("fn::select", e.Values)
+		case *ast.JoinExpr:
+			d.checkListArgument("fn::join", e.Values)
+		case *ast.SplitExpr:
+			d.checkStringArgument("fn::split", e.Source)
+		case *ast.ToBase64Expr:
+			d.checkStringArgument("fn::toBase64", e.Value)
+		case *ast.FromBase64Expr:
+			d.checkStringArgument("fn::fromBase64", e.Value)
+		}
+	})
+}
+
+func (d *Decl) checkListArgument(builtin string, arg ast.Expr) {
+	if t := d.typeExpr(arg); t != nil {
+		if _, ok := elementType(t); !ok {
+			d.diags = append(d.diags, builtinArgumentTypeDiag(builtin, "a list", t, exprRange(arg)))
+		}
+	}
+}
+
+func (d *Decl) checkStringArgument(builtin string, arg ast.Expr) {
+	if t := d.typeExpr(arg); isStructured(t) {
+		d.diags = append(d.diags, builtinArgumentTypeDiag(builtin, "a string", t, exprRange(arg)))
+	}
+}
+
+// walkExprs calls `visit` on every expression in the template, parents before
+// their children.
+func (d *Decl) walkExprs(visit func(ast.Expr)) {
+	var walk func(e ast.Expr)
+	walk = func(e ast.Expr) {
+		if e == nil {
+			return
+		}
+		visit(e)
+		for _, child := range exprChildren(e) {
+			walk(child)
+		}
+	}
+	// Walk in a stable order, so diagnostics are reported consistently.
+	names := util.MapKeys(d.variables)
+	sort.Strings(names)
+	for _, name := range names {
+		switch def := d.variables[name].definition.(type) {
+		case *VariableMapEntry:
+			walk(def.Value)
+		case *Resource:
+			if def.defined.Value == nil {
+				continue
+			}
+			for _, entry := range def.defined.Value.Properties.Entries {
+				walk(entry.Value)
+			}
+			for _, entry := range def.defined.Value.Get.State.Entries {
+				walk(entry.Value)
+			}
+			// The other options are literals, which the parser checks.
+			opts := def.defined.Value.Options
+			for _, e := range []ast.Expr{
+				opts.DependsOn, opts.Parent, opts.Protect, opts.Provider, opts.Providers, opts.DeletedWith,
+			} {
+				walk(e)
+			}
+		}
+	}
+	outputs := util.MapKeys(d.outputs)
+	sort.Strings(outputs)
+	for _, name := range outputs {
+		walk(d.outputs[name].Value)
+	}
+}
+
+// The expressions directly nested in `e`.
+func exprChildren(e ast.Expr) []ast.Expr {
+	switch e := e.(type) {
+	case *ast.ListExpr:
+		return e.Elements
+	case *ast.ObjectExpr:
+		children := make([]ast.Expr, 0, len(e.Entries))
+		for _, entry := range e.Entries {
+			children = append(children, entry.Key, entry.Value)
+		}
+		return children
+	case *ast.InvokeExpr:
+		if e.CallArgs == nil {
+			return nil
+		}
+		return []ast.Expr{e.CallArgs}
+	case *ast.AssetArchiveExpr:
+		keys := util.MapKeys(e.AssetOrArchives)
+		sort.Strings(keys)
+		children := make([]ast.Expr, len(keys))
+		for i, k := range keys {
+			children[i] = e.AssetOrArchives[k]
+		}
+		return children
+	case *ast.FileArchiveExpr:
+		return []ast.Expr{e.Source}
+	case *ast.FileAssetExpr:
+		return []ast.Expr{e.Source}
+	case *ast.RemoteArchiveExpr:
+		return []ast.Expr{e.Source}
+	case *ast.RemoteAssetExpr:
+		return []ast.Expr{e.Source}
+	case *ast.StringAssetExpr:
+		return []ast.Expr{e.Source}
+	case *ast.ReadFileExpr:
+		return []ast.Expr{e.Path}
+	case *ast.SecretExpr:
+		return []ast.Expr{e.Value}
+	case *ast.JoinExpr:
+		return []ast.Expr{e.Delimiter, e.Values}
+	case *ast.SelectExpr:
+		return []ast.Expr{e.Index, e.Values}
+	case *ast.SplitExpr:
+		return []ast.Expr{e.Delimiter, e.Source}
+	case *ast.ToBase64Expr:
+		return []ast.Expr{e.Value}
+	case *ast.FromBase64Expr:
+		return []ast.Expr{e.Value}
+	case *ast.ToJSONExpr:
+		return []ast.Expr{e.Value}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package bind
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+)
+
+// PackageUse is a place in the template that uses a package: a resource, an
+// invoke or an entry in `plugins.providers`.
+type PackageUse struct {
+	Package string
+	// The version as written in the template, or "" if the default version is
+	// used.
+	Version string
+	// The location of the version, or nil if the default version is used.
+	VersionRange *hcl.Range
+	// The location of the resource type or function token. TokenRange is nil
+	// for `plugins.providers` entries.
+	TokenRange *hcl.Range
+}
+
+// Describe the version used, as part of a diagnostic.
+func (u PackageUse) displayVersion() string {
+	if u.Version == "" {
+		return "the default version"
+	}
+	return "version " + u.Version
+}
+
+// Compare versions by semantic version if possible, so that `v5.1.0` and
+// `5.1.0` are the same version.
+func (u PackageUse) normalizedVersion() string {
+	if v, err := semver.ParseTolerant(u.Version); err == nil {
+		return v.String()
+	}
+	return u.Version
+}
+
+// VersionConflict is attached to diagnostics about a package that is used at
+// different versions in the same template.
+type VersionConflict struct {
+	Package string
+	// Every use of the package, in the order they appear in the template.
+	Uses []PackageUse
+}
+
+// Versions lists the distinct versions pinned by the conflicting uses, in the
+// order they first appear. The default version is not listed.
+func (c VersionConflict) Versions() []string {
+	seen := map[string]bool{}
+	var versions []string
+	for _, u := range c.Uses {
+		if u.Version == "" || seen[u.normalizedVersion()] {
+			continue
+		}
+		seen[u.normalizedVersion()] = true
+		versions = append(versions, u.Version)
+	}
+	return versions
+}
+
+// The packages used by resources and invokes, in the order they appear in the
+// template.
+func (d *Decl) packageUses() []PackageUse {
+	var uses []PackageUse
+	add := func(token *ast.StringExpr, version *ast.StringExpr) {
+		pkg, ok := PackageName(token.GetValue())
+		if !ok {
+			return
+		}
+		use := PackageUse{Package: pkg, TokenRange: exprRange(token)}
+		if v := version.GetValue(); v != "" {
+			use.Version, use.VersionRange = v, exprRange(version)
+		}
+		uses = append(uses, use)
+	}
+	for _, v := range d.variables {
+		if r, ok := v.definition.(*Resource); ok && r.defined.Value != nil {
+			add(r.defined.Value.Type, r.defined.Value.Options.Version)
+		}
+	}
+	for invoke := range d.invokes {
+		add(invoke.defined.Token, invoke.defined.CallOpts.Version)
+	}
+	sortUses(uses)
+	return uses
+}
+
+func sortUses(uses []PackageUse) {
+	start := func(u PackageUse) hcl.Pos {
+		if u.TokenRange != nil {
+			return u.TokenRange.Start
+		}
+		if u.VersionRange != nil {
+			return u.VersionRange.Start
+		}
+		return hcl.Pos{}
+	}
+	sort.SliceStable(uses, func(i, j int) bool {
+		a, b := start(uses[i]), start(uses[j])
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// The providers listed in `plugins.providers`. The `plugins` section is not part
+// of the template AST, so it is read from the syntax tree.
+func pluginUses(template *ast.TemplateDecl) []PackageUse {
+	root, ok := template.Syntax().(*syntax.ObjectNode)
+	if !ok {
+		return nil
+	}
+	plugins, ok := syntaxProperty(root, "plugins").(*syntax.ObjectNode)
+	if !ok {
+		return nil
+	}
+	providers, ok := syntaxProperty(plugins, "providers").(*syntax.ListNode)
+	if !ok {
+		return nil
+	}
+	var uses []PackageUse
+	for i := 0; i < providers.Len(); i++ {
+		provider, ok := providers.Index(i).(*syntax.ObjectNode)
+		if !ok {
+			continue
+		}
+		name, ok := syntaxProperty(provider, "name").(*syntax.StringNode)
+		if !ok {
+			continue
+		}
+		version, ok := syntaxProperty(provider, "version").(*syntax.StringNode)
+		if !ok || version.Value() == "" || version.Syntax() == nil {
+			// Providers without a version don't pin one.
+			continue
+		}
+		uses = append(uses, PackageUse{
+			Package:      name.Value(),
+			Version:      version.Value(),
+			VersionRange: version.Syntax().Range(),
+		})
+	}
+	return uses
+}
+
+func syntaxProperty(n *syntax.ObjectNode, key string) syntax.Node {
+	for i := 0; i < n.Len(); i++ {
+		if p := n.Index(i); p.Key != nil && p.Key.Value() == key {
+			return p.Value
+		}
+	}
+	return nil
+}
+
+// Warn when the template uses different versions of the same package. Each
+// version loads its own schema, which is rarely intended.
+//
+// A warning is reported at each pinned version, pointing to the uses of other
+// versions.
+func (d *Decl) checkVersionConflicts(template *ast.TemplateDecl) {
+	uses := append(d.packageUses(), pluginUses(template)...)
+	sortUses(uses)
+	byPackage := map[string][]PackageUse{}
+	var packages []string
+	for _, u := range uses {
+		if _, ok := byPackage[u.Package]; !ok {
+			packages = append(packages, u.Package)
+		}
+		byPackage[u.Package] = append(byPackage[u.Package], u)
+	}
+	for _, pkg := range packages {
+		uses := byPackage[pkg]
+		versions := map[string]bool{}
+		for _, u := range uses {
+			versions[u.normalizedVersion()] = true
+		}
+		if len(versions) < 2 {
+			continue
+		}
+		conflict := VersionConflict{Package: pkg, Uses: uses}
+		for _, u := range uses {
+			if u.VersionRange == nil {
+				continue
+			}
+			var related []RelatedInformation
+			for _, other := range uses {
+				if other.normalizedVersion() == u.normalizedVersion() {
+					continue
+				}
+				loc := other.VersionRange
+				if loc == nil {
+					loc = other.TokenRange
+				}
+				related = append(related, RelatedInformation{
+					Message: fmt.Sprintf("'%s' is used at %s here", pkg, other.displayVersion()),
+					Range:   loc,
+				})
+			}
+			d.diags = append(d.diags, conflictingVersionsDiag(u, conflict, related))
+		}
+	}
+}
+
+// CheckInstalledVersions warns about package versions pinned with
+// `options.version` that are not installed. `installed` maps each package to
+// its installed plugin versions.
+//
+// Loading a package at a version that is not installed may download it, or fail
+// if it can't be downloaded.
+func (d *Decl) CheckInstalledVersions(installed map[string][]semver.Version) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, use := range d.packageUses() {
+		if use.Version == "" {
+			continue
+		}
+		version, err := semver.ParseTolerant(use.Version)
+		if err != nil {
+			// Invalid versions are reported when the package is loaded.
+			continue
+		}
+		found := false
+		for _, v := range installed[use.Package] {
+			found = found || v.EQ(version)
+		}
+		if !found {
+			d.diags = append(d.diags, versionNotInstalledDiag(use.Package, version, installed[use.Package], use.VersionRange))
+		}
+	}
+}
+
+// Display a list of versions, as part of a diagnostic.
+func displayVersions(versions []semver.Version) string {
+	contract.Assertf(len(versions) > 0, "no versions to display")
+	s := make([]string, len(versions))
+	for i, v := range versions {
+		s[i] = v.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// PackageName returns the name of the package that defines the resource or
+// function token `tk`. Provider tokens belong to the package they provide.
+func PackageName(tk string) (string, bool) {
+	name, err := pkgNameFromToken(tk)
+	return name, err == nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+// The indentation used when the document's indentation can't be detected.
+const defaultIndentation = 2
+
+// indentation returns the number of spaces that nest a block one level deeper in
+// `text`. The document's own indentation is preferred, then the tab size
+// configured by the client.
+func (s *server) indentation(text lsp.Document) int {
+	if n, ok := documentIndentation(text); ok {
+		return n
+	}
+	if s.tabSize > 0 {
+		return s.tabSize
+	}
+	return defaultIndentation
+}
+
+// indentUnit returns the spaces that nest a block one level deeper in `text`.
+func (s *server) indentUnit(text lsp.Document) string {
+	return strings.Repeat(" ", s.indentation(text))
+}
+
+// Offer quick fixes for the diagnostics in the requested range.
+func (s *server) codeAction(client lsp.Client, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	uri := params.TextDocument.URI
+	doc, ok := s.getDocument(uri)
+	if !ok {
+		return nil, fmt.Errorf("could not find an opened document %s", uri.Filename())
+	}
+	if doc.analysis == nil {
+		// Stack files don't have quick fixes.
+		return nil, nil
+	}
+	bound, ok := doc.analysis.bound.TryGetResult()
+	if !ok || bound.A == nil {
+		// We can try again later.
+		return nil, nil
+	}
+	actions := []protocol.CodeAction{}
+	for _, diag := range bound.A.Diags() {
+		extra, ok := bind.Extra(diag)
+		if !ok || diag.Subject == nil || !rangesOverlap(convertRange(diag.Subject), params.Range) {
+			continue
+		}
+		switch {
+		case extra.Secret != nil:
+			actions = append(actions, s.secretActions(doc, convertDiagnostic(diag, uri), *extra.Secret)...)
+		case extra.VersionConflict != nil:
+			actions = append(actions, s.versionActions(doc, convertDiagnostic(diag, uri), *extra.VersionConflict)...)
+		}
+	}
+	return actions, nil
+}
+
+// secretActions offers to wrap a plaintext secret in `fn::secret`, or to move it
+// into a secret configuration entry.
+func (s *server) secretActions(doc *document, diag protocol.Diagnostic, secret bind.PlaintextSecret) []protocol.CodeAction {
+	uri := doc.text.URI()
+	var actions []protocol.CodeAction
+	if edits, ok := s.wrapSecretEdits(doc, secret); ok {
+		actions = append(actions, protocol.CodeAction{
+			Title:       "Wrap the value in fn::secret",
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			IsPreferred: true,
+			Edit:        &protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edits}},
+		})
+	}
+	if edits, ok := s.moveSecretToConfigEdits(doc, secret); ok {
+		actions = append(actions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Move the value into the secret configuration entry '%s'", secret.ConfigName),
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit:        &protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edits}},
+		})
+	}
+	return actions
+}
+
+// wrapSecretEdits wraps the value of `secret` in `fn::secret`. Values whose
+// layout we can't safely rewrite, such as multi-line strings, are not wrapped.
+func (s *server) wrapSecretEdits(doc *document, secret bind.PlaintextSecret) ([]protocol.TextEdit, bool) {
+	rnge, ok := syntaxRange(secret.Value)
+	if !ok {
+		return nil, false
+	}
+	start := convertPosition(rnge.Start)
+	line, err := doc.text.Line(int(start.Line))
+	if err != nil || int(start.Character) > len(line) {
+		return nil, false
+	}
+	before := strings.TrimSpace(line[:start.Character])
+	block := isBlockCollection(secret.Value, line[start.Character:])
+
+	switch {
+	case block && before == "" && secret.Key != nil:
+		// The value is a block map or list on its own lines, so it is indented
+		// under a new `fn::secret` key.
+		end := convertPosition(rnge.End)
+		indent, unit := line[:start.Character], s.indentUnit(doc.text)
+		edits := []protocol.TextEdit{{
+			Range:   protocol.Range{Start: protocol.Position{Line: start.Line}, End: protocol.Position{Line: start.Line}},
+			NewText: indent + "fn::secret:\n" + unit,
+		}}
+		for l := start.Line + 1; l <= end.Line; l++ {
+			edits = append(edits, protocol.TextEdit{
+				Range:   protocol.Range{Start: protocol.Position{Line: l}, End: protocol.Position{Line: l}},
+				NewText: unit,
+			})
+		}
+		return edits, true
+	case block || rnge.Start.Line != rnge.End.Line:
+		return nil, false
+	case before == "" || before == "-":
+		// The value starts its line, or is a list element: `fn::secret` can go
+		// right before it.
+		return []protocol.TextEdit{{
+			Range:   protocol.Range{Start: start, End: start},
+			NewText: "fn::secret: ",
+		}}, true
+	case secret.Key != nil:
+		// The value follows its key, so it moves to a new line below the key.
+		keyRange, ok := syntaxRange(secret.Key)
+		if !ok || keyRange.Start.Line != rnge.Start.Line {
+			return nil, false
+		}
+		keyStart := convertPosition(keyRange.Start)
+		if prefix := strings.TrimSpace(line[:keyStart.Character]); prefix != "" && prefix != "-" {
+			// The key is part of a flow map.
+			return nil, false
+		}
+		indent := strings.Repeat(" ", int(keyStart.Character)) + s.indentUnit(doc.text)
+		// Replace the space after the key, to avoid leaving trailing whitespace.
+		afterKey := protocol.Position{
+			Line:      start.Line,
+			Character: uint32(len(strings.TrimRight(line[:start.Character], " "))),
+		}
+		return []protocol.TextEdit{{
+			Range:   protocol.Range{Start: afterKey, End: start},
+			NewText: "\n" + indent + "fn::secret: ",
+		}}, true
+	}
+	return nil, false
+}
+
+// moveSecretToConfigEdits replaces the value of `secret` with a reference to a
+// new secret configuration entry. The value itself is dropped: it should be set
+// with `pulumi config set --secret`.
+func (s *server) moveSecretToConfigEdits(doc *document, secret bind.PlaintextSecret) ([]protocol.TextEdit, bool) {
+	if secret.ConfigName == "" {
+		return nil, false
+	}
+	rnge, ok := syntaxRange(secret.Value)
+	if !ok {
+		return nil, false
+	}
+	replace, _, ok := scalarRange(doc.text, rnge)
+	if !ok {
+		return nil, false
+	}
+	edits := []protocol.TextEdit{{
+		Range:   replace,
+		NewText: "${" + secret.ConfigName + "}",
+	}}
+	return append(edits, s.newConfigEdit(doc, secret.ConfigName, secret.ConfigType)), true
+}
+
+// newConfigEdit adds a secret configuration entry to the `config` section,
+// creating the section if necessary.
+func (s *server) newConfigEdit(doc *document, name, typ string) protocol.TextEdit {
+	entry := func(indent string) string {
+		return indent + name + ":\n" +
+			indent + indent + "type: " + typ + "\n" +
+			indent + indent + "secret: true\n"
+	}
+	keys, _ := topLevelKeys(doc)
+	for _, section := range []string{"config", "configuration"} {
+		pos, ok := keys[section]
+		if !ok {
+			continue
+		}
+		if line, err := doc.text.Line(int(pos.Line)); err != nil || strings.TrimSpace(line) != section+":" {
+			// The section is not a block map.
+			continue
+		}
+		indent := s.indentUnit(doc.text)
+		if children, err := childKeys(doc, pos); err == nil {
+			for _, child := range children {
+				indent = strings.Repeat(" ", int(child.Character))
+				break
+			}
+		}
+		at := protocol.Position{Line: pos.Line + 1}
+		return protocol.TextEdit{Range: protocol.Range{Start: at, End: at}, NewText: entry(indent)}
+	}
+	section := "config:\n" + entry(s.indentUnit(doc.text))
+	if pos, ok := keys["resources"]; ok {
+		at := protocol.Position{Line: pos.Line}
+		return protocol.TextEdit{Range: protocol.Range{Start: at, End: at}, NewText: section}
+	}
+	last := doc.text.LineLen() - 1
+	lastLine, _ := doc.text.Line(last)
+	at := protocol.Position{Line: uint32(last), Character: uint32(len(lastLine))}
+	if lastLine != "" {
+		section = "\n" + section
+	}
+	return protocol.TextEdit{Range: protocol.Range{Start: at, End: at}, NewText: section}
+}
+
+// scalarRange finds the full range of the single line scalar at `rnge`,
+// including any quotes. It also reports if the scalar is quoted.
+func scalarRange(text lsp.Document, rnge *hcl.Range) (protocol.Range, bool, bool) {
+	if rnge.Start.Line != rnge.End.Line {
+		return protocol.Range{}, false, false
+	}
+	start, end := convertPosition(rnge.Start), convertPosition(rnge.End)
+	line, err := text.Line(int(start.Line))
+	if err != nil || int(start.Character) >= len(line) {
+		return protocol.Range{}, false, false
+	}
+	// The range of a quoted string doesn't include its quotes.
+	quoted := false
+	if q := line[start.Character]; q == '"' || q == '\'' {
+		closing, ok := closingQuote(line, int(start.Character))
+		if !ok {
+			return protocol.Range{}, false, false
+		}
+		end.Character = uint32(closing + 1)
+		quoted = true
+	}
+	return protocol.Range{Start: start, End: end}, quoted, true
+}
+
+// closingQuote finds the quote that closes the YAML string starting at `start`.
+func closingQuote(line string, start int) (int, bool) {
+	q := line[start]
+	for i := start + 1; i < len(line); i++ {
+		switch {
+		case q == '"' && line[i] == '\\':
+			i++
+		case q == '\'' && line[i] == '\'' && i+1 < len(line) && line[i+1] == '\'':
+			i++
+		case line[i] == q:
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// isBlockCollection checks if `e` is a map or list in block style. `rest` is the
+// text of the line from the start of `e`.
+func isBlockCollection(e ast.Expr, rest string) bool {
+	switch e.Syntax().(type) {
+	case *syntax.ObjectNode, *syntax.ListNode:
+		return !strings.HasPrefix(rest, "{") && !strings.HasPrefix(rest, "[")
+	}
+	return false
+}
+
+func syntaxRange(e ast.Expr) (*hcl.Range, bool) {
+	if e == nil || e.Syntax() == nil || e.Syntax().Syntax() == nil {
+		return nil, false
+	}
+	r := e.Syntax().Syntax().Range()
+	return r, r != nil
+}
+
+// Check if two ranges share any position.
+func rangesOverlap(a, b protocol.Range) bool {
+	return !posGreaterThen(a.End, b.Start) && !posGreaterThen(b.End, a.Start)
+}
@@ -0,0 +1,229 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
+)
+
+// secretDiags binds `text`, returning the diagnostics about plaintext secrets.
+func secretDiags(t *testing.T, text string) (hclDiags []protocol.Diagnostic, secrets []bind.PlaintextSecret) {
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(text))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors(), diags.Error())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), testutil.Loader(testutil.Package()))
+	for _, diag := range decl.Diags() {
+		if extra, ok := bind.Extra(diag); ok && extra.Secret != nil {
+			hclDiags = append(hclDiags, convertDiagnostic(diag, "file:///Pulumi.yaml"))
+			secrets = append(secrets, *extra.Secret)
+		}
+	}
+	return hclDiags, secrets
+}
+
+// applyEdits applies non-overlapping text edits to `text`.
+func applyEdits(t *testing.T, text string, edits []protocol.TextEdit) string {
+	doc := lsp.NewDocument(protocol.TextDocumentItem{URI: "file:///Pulumi.yaml", Text: text})
+	// Apply the edits from last to first so earlier positions stay valid.
+	// Inserts at the same position keep their order.
+	edits = append([]protocol.TextEdit{}, edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		return posGreaterThen(edits[i].Range.Start, edits[j].Range.Start)
+	})
+	for i := len(edits) - 1; i >= 0; i-- {
+		err := doc.AcceptChanges([]protocol.TextDocumentContentChangeEvent{{
+			Range: edits[i].Range,
+			Text:  edits[i].NewText,
+		}})
+		require.NoError(t, err)
+	}
+	return doc.String()
+}
+
+func TestSecretActions(t *testing.T) {
+	const text = `name: test
+runtime: yaml
+resources:
+  db:
+    type: test:index:Database
+    properties:
+      password: "hunter2"
+      users:
+        - password: hunter2
+outputs:
+  connection: ${db.connectionString}
+  all:
+    - ${db.connectionString}
+`
+	diags, secrets := secretDiags(t, text)
+	require.Len(t, secrets, 4)
+
+	actions := func(i int) []protocol.CodeAction {
+		doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{URI: "file:///Pulumi.yaml", Text: text})}
+		return (&server{}).secretActions(doc, diags[i], secrets[i])
+	}
+	edits := func(a protocol.CodeAction) []protocol.TextEdit {
+		return a.Edit.Changes["file:///Pulumi.yaml"]
+	}
+
+	password := actions(0)
+	require.Len(t, password, 2)
+	assert.Equal(t, "Move the value into the secret configuration entry 'dbPassword'", password[1].Title)
+	assert.Equal(t, `name: test
+runtime: yaml
+config:
+  dbPassword:
+    type: String
+    secret: true
+resources:
+  db:
+    type: test:index:Database
+    properties:
+      password: ${dbPassword}
+      users:
+        - password: hunter2
+outputs:
+  connection: ${db.connectionString}
+  all:
+    - ${db.connectionString}
+`, applyEdits(t, text, edits(password[1])))
+
+	// Wrapping every value in `fn::secret` fixes every diagnostic.
+	var all []protocol.TextEdit
+	for i := range secrets {
+		a := actions(i)
+		require.NotEmpty(t, a)
+		assert.Equal(t, "Wrap the value in fn::secret", a[0].Title)
+		all = append(all, edits(a[0])...)
+	}
+	wrapped := applyEdits(t, text, all)
+	assert.Equal(t, `name: test
+runtime: yaml
+resources:
+  db:
+    type: test:index:Database
+    properties:
+      password:
+        fn::secret: "hunter2"
+      users:
+        - password:
+            fn::secret: hunter2
+outputs:
+  connection:
+    fn::secret: ${db.connectionString}
+  all:
+    fn::secret:
+      - ${db.connectionString}
+`, wrapped)
+	diags, _ = secretDiags(t, wrapped)
+	assert.Empty(t, diags)
+}
+
+func TestVersionActions(t *testing.T) {
+	const text = `name: test
+runtime: yaml
+resources:
+  default:
+    type: aws:s3:Bucket
+    properties:
+      acl: private
+  withOptions:
+    type: aws:s3:Bucket
+    options:
+      protect: true
+  pinned:
+    type: aws:s3:Bucket
+    options:
+      version: "4.0.0"
+variables:
+  vpc:
+    fn::invoke:
+      function: aws:ec2:getVpc
+      options:
+        version: 5.16.2
+`
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(text))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors(), diags.Error())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+
+	var conflict *bind.VersionConflict
+	var diag protocol.Diagnostic
+	for _, d := range decl.Diags() {
+		if extra, ok := bind.Extra(d); ok && extra.VersionConflict != nil {
+			conflict, diag = extra.VersionConflict, convertDiagnostic(d, "file:///Pulumi.yaml")
+			break
+		}
+	}
+	require.NotNil(t, conflict)
+
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{URI: "file:///Pulumi.yaml", Text: text})}
+	actions := (&server{}).versionActions(doc, diag, *conflict)
+	require.Len(t, actions, 2)
+	assert.Equal(t, "Use version 4.0.0 of 'aws' everywhere", actions[0].Title)
+	assert.Equal(t, "Use version 5.16.2 of 'aws' everywhere", actions[1].Title)
+	assert.Equal(t, `name: test
+runtime: yaml
+resources:
+  default:
+    type: aws:s3:Bucket
+    options:
+      version: 5.16.2
+    properties:
+      acl: private
+  withOptions:
+    type: aws:s3:Bucket
+    options:
+      version: 5.16.2
+      protect: true
+  pinned:
+    type: aws:s3:Bucket
+    options:
+      version: "5.16.2"
+variables:
+  vpc:
+    fn::invoke:
+      function: aws:ec2:getVpc
+      options:
+        version: 5.16.2
+`, applyEdits(t, text, actions[1].Edit.Changes["file:///Pulumi.yaml"]))
+}
+
+func TestSecretActionsTabSize(t *testing.T) {
+	// The document has no nested blocks, so its indentation can't be detected.
+	const text = `name: test
+runtime: yaml
+resources: {db: {type: "test:index:Database", properties: {password: hunter2}}}
+`
+	diags, secrets := secretDiags(t, text)
+	require.Len(t, secrets, 1)
+
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{URI: "file:///Pulumi.yaml", Text: text})}
+	actions := (&server{tabSize: 4}).secretActions(doc, diags[0], secrets[0])
+	// Values in flow maps can't be wrapped in place, so only the move is offered.
+	require.Len(t, actions, 1)
+	assert.Equal(t, `name: test
+runtime: yaml
+config:
+    dbPassword:
+        type: String
+        secret: true
+resources: {db: {type: "test:index:Database", properties: {password: ${dbPassword}}}}
+`, applyEdits(t, text, actions[0].Edit.Changes["file:///Pulumi.yaml"]))
+}
@@ -10,12 +10,13 @@ import (
 	"go.lsp.dev/protocol"
 
 	"github.com/blang/semver"
-	"github.com/pulumi/pulumi/pkg/v3/codegen"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
 
 	"github.com/pulumi/pulumi-lsp/sdk/lsp"
 	"github.com/pulumi/pulumi-lsp/sdk/util"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
 )
 
 const FnPrefix = "fn::"
@@ -27,8 +28,11 @@ func (s *server) completeReference(c lsp.Client, doc *document, ref *Reference)
 		return nil, err
 	}
 	accessors := ref.ref.Accessors()
-	b, ok := doc.analysis.bound.GetResult()
-	contract.Assertf(ok, "Should have exited already if the bind task failed")
+	b, ok := doc.analysis.bound.GetResultContext(c.Context())
+	if !ok {
+		// Either the request or the analysis was canceled.
+		return nil, nil
+	}
 
 	// We go through this song and dance to figure out if a property access list
 	// ends in a "."
@@ -83,7 +87,7 @@ func (s *server) completeReference(c lsp.Client, doc *document, ref *Reference)
 //	complete to ["someType.foo", "someType.bar"].
 func (s *server) typePropertyCompletion(t schema.Type, filterPrefix string) (*protocol.CompletionList, error) {
 	var props []*schema.Property
-	switch t := codegen.UnwrapType(t).(type) {
+	switch t := bind.UnwrapType(t).(type) {
 	case *schema.ResourceType:
 		props = util.ResourceProperties(t.Resource)
 	case *schema.ObjectType:
@@ -115,7 +119,12 @@ func (s *server) propertyListCompletion(l []*schema.Property, filterPrefix strin
 }
 
 func completionItemFromType(t schema.Type) protocol.CompletionItem {
-	t = codegen.UnwrapType(t)
+	if bind.IsSecret(t) {
+		item := completionItemFromType(bind.UnwrapType(t))
+		item.Detail = fmt.Sprintf("secret<%s>", item.Detail)
+		return item
+	}
+	t = bind.UnwrapType(t)
 	switch t {
 	case schema.StringType:
 		return protocol.CompletionItem{
@@ -162,17 +171,22 @@ func completionItemFromType(t schema.Type) protocol.CompletionItem {
 			Documentation: documentation,
 		}
 	case *schema.ObjectType:
+		token := t.Token
+		if token == "" {
+			// Object literals are described by their shape.
+			token = diags.DisplayType(t)
+		}
 		return protocol.CompletionItem{
 			Kind:          protocol.CompletionItemKindInterface,
-			Detail:        fmt.Sprintf("object %s", t.Token),
+			Detail:        fmt.Sprintf("object %s", token),
 			Documentation: t.Comment,
 		}
 	case *schema.UnionType:
 		var detail string
-		if len(t.ElementTypes) == 0 {
+		if len(t.ElementTypes) != 0 {
 			detail = completionItemFromType(t.ElementTypes[0]).Detail
 			for i := 1; i < len(t.ElementTypes); i++ {
-				detail += "| " + completionItemFromType(t.ElementTypes[i]).Detail
+				detail += " | " + completionItemFromType(t.ElementTypes[i]).Detail
 			}
 		}
 		return protocol.CompletionItem{
@@ -219,7 +233,7 @@ func (s *server) completeType(client lsp.Client, doc *document, params *protocol
 	line = strings.TrimSpace(line)
 
 	version := func() *semver.Version {
-		sibs, ok, err := siblingKeys(doc.text, pos)
+		sibs, ok, err := siblingKeys(doc, pos)
 		if err == nil || !ok {
 			return nil
 		}
@@ -227,12 +241,12 @@ func (s *server) completeType(client lsp.Client, doc *document, params *protocol
 		if !ok {
 			return nil
 		}
-		v, ok, err := getNestedKey(doc.text, opts, "version")
+		v, ok, err := getNestedKey(doc, opts, "version")
 		if !ok || err != nil {
 			return nil
 		}
 
-		s, err := extractVersionString(doc.text, v)
+		s, err := extractVersionString(doc, v)
 		if err != nil {
 			return nil
 		}
@@ -293,7 +307,10 @@ func (s *server) completeType(client lsp.Client, doc *document, params *protocol
 						}},
 					}, nil
 				}
-				pkg, err := s.schemas.LoadPackageReference(parts[0], version())
+				pkg, err := s.schemas.LoadPackageReferenceV2(client.Context(), &schema.PackageDescriptor{
+					Name:    parts[0],
+					Version: version(),
+				})
 				if err != nil {
 					return nil, err
 				}
@@ -323,7 +340,10 @@ func (s *server) completeType(client lsp.Client, doc *document, params *protocol
 					// There are no valid completions for this token
 					return nil, nil
 				}
-				pkg, err := s.schemas.LoadPackageReference(parts[0], version())
+				pkg, err := s.schemas.LoadPackageReferenceV2(client.Context(), &schema.PackageDescriptor{
+					Name:    parts[0],
+					Version: version(),
+				})
 				if err != nil {
 					return nil, err
 				}
@@ -494,17 +514,20 @@ func (s *server) completeKey(c lsp.Client, doc *document, params *protocol.Compl
 	}
 
 	// The cursor is past key we are completing, so don't complete anything
-	if endOfNthField(line, 1) < int(params.Position.Character) {
+	flow, onKey := flowKeyAt(doc, params.Position)
+	if flow && !onKey || !flow && endOfNthField(line, 1) < int(params.Position.Character) {
 		return nil, nil
 	}
 
-	parents, indentation, ok, err := parentKeys(doc.text, params.Position)
+	parents, _, ok, err := parentKeys(doc, params.Position)
 	parents = util.ReverseList(parents)
 	if err != nil {
 		c.LogDebugf("Could not find enclosing (ok=%t) (err=%v)", ok, err)
 		return nil, err
 	}
-	post := postFix{indentation}
+	post := postFix{indentation: s.indentation(doc.text), flow: flow}
+	// The nesting depth of the values of completed keys.
+	depth := len(parents) + 1
 
 	matchesPath := func(path ...string) bool {
 		if len(parents) < len(path) {
@@ -520,35 +543,53 @@ func (s *server) completeKey(c lsp.Client, doc *document, params *protocol.Compl
 	}
 
 	providedCompletions := func(options []option) (*protocol.CompletionList, error) {
-		return providedCompletions(doc, parents[0].A, len(parents)+1, options)
+		return providedCompletions(doc, parents[0].A, depth, options)
 	}
 
 	switch {
 	case !ok: // We are at the top level
-		// NOTE We assume that we are completing to 2 spaces
-		return completeTopLevelKeys(doc, postFix{2})
+		return completeTopLevelKeys(doc, post)
 
 	// Completing for the ResourceOptions decl
 	case len(parents) == 3 &&
 		strings.ToLower(parents[0].B) == "options" &&
 		strings.ToLower(parents[2].B) == "resources":
-		return completeResourceOptionsKeys(doc, parents[0].A, post)
+		return completeResourceOptionsKeys(doc, parents[0].A, post, depth)
 
 	// Completing for the Resource decl
 	case len(parents) == 2 && strings.ToLower(parents[1].B) == "resources":
 		return completeResourceKeys(doc, parents[0].A, post)
 
+	// Completing for a resource read
+	case len(parents) == 3 && matchesPath("get") && strings.ToLower(parents[2].B) == "resources":
+		return providedCompletions([]option{
+			{"id", "string", "The ID of the resource to read.", post.sameLine},
+			{"state", "map<string, any>", "State used to disambiguate the resource to read.", post.intoObject},
+		})
+	case len(parents) == 4 && matchesPath("get", "state") && strings.ToLower(parents[3].B) == "resources":
+		return completeResourceStateKeys(c, doc, parents[1].A, parents[0].A, s, post, depth)
+
+	// Completing for the customTimeouts resource option
+	case len(parents) == 4 && matchesPath("customtimeouts") &&
+		strings.ToLower(parents[1].B) == "options" &&
+		strings.ToLower(parents[3].B) == "resources":
+		options := []option{}
+		for _, op := range []string{"create", "update", "delete"} {
+			options = append(options, option{op, "duration", customTimeoutDocs[op], post.sameLine})
+		}
+		return providedCompletions(options)
+
 	case len(parents) == 1 && strings.ToLower(parents[0].B) == "plugins":
-		return completePluginsKeys(doc, parents[0].A, postFix{2})
+		return completePluginsKeys(doc, parents[0].A, post, depth)
 	case len(parents) == 2 && strings.ToLower(parents[0].B) == "plugins" &&
 		strings.ToLower(parents[1].B) == "providers":
-		return completePluginProvidersKeys(doc, parents[1].A, postFix{2})
+		return completePluginProvidersKeys(doc, parents[1].A, post, depth)
 
 	// The properties key in a resource
 	case len(parents) == 3 &&
 		strings.ToLower(parents[0].B) == "properties" &&
 		strings.ToLower(parents[2].B) == "resources":
-		return completeResourcePropertyKeys(c, doc, parents[0].A, s, post)
+		return completeResourcePropertyKeys(c, doc, parents[0].A, s, post, depth)
 
 	// Arbitrarily nested completion items
 	case matchesPath("fn::invoke", "arguments"):
@@ -575,7 +616,7 @@ func (s *server) completeKey(c lsp.Client, doc *document, params *protocol.Compl
 		line = strings.TrimSpace(line)
 
 		if len(parents) >= 2 && strings.HasPrefix(strings.ToLower(line), "fn::") {
-			return completeFnShorthand(c, line, len(parents)+1, post, s)
+			return completeFnShorthand(c, line, depth, post, s)
 		}
 		return nil, nil
 	}
@@ -644,7 +685,7 @@ func completeFnShorthand(c lsp.Client, line string, indentLevel int, postFix pos
 				return nil, nil
 			}
 		}
-		pkg, err := s.schemas.LoadPackageReference(parts[0], nil)
+		pkg, err := s.schemas.LoadPackageReferenceV2(c.Context(), &schema.PackageDescriptor{Name: parts[0]})
 		if err != nil {
 			return nil, err
 		}
@@ -702,7 +743,7 @@ func completeFnShorthand(c lsp.Client, line string, indentLevel int, postFix pos
 
 	case 3:
 		// Here we are completing only invokes in specific modules
-		pkg, err := s.schemas.LoadPackageReference(parts[0], nil)
+		pkg, err := s.schemas.LoadPackageReferenceV2(c.Context(), &schema.PackageDescriptor{Name: parts[0]})
 		if err != nil {
 			return nil, err
 		}
@@ -749,14 +790,13 @@ func completeFnShorthand(c lsp.Client, line string, indentLevel int, postFix pos
 }
 
 func completeTopLevelKeys(doc *document, postFix postFix) (*protocol.CompletionList, error) {
-	sibs, err := topLevelKeys(doc.text)
+	sibs, err := topLevelKeys(doc)
 	if err != nil {
 		return nil, err
 	}
 	setDetails := func(detail string, post func(int) string) func(*protocol.CompletionItem) {
 		return func(c *protocol.CompletionItem) {
 			c.Detail = detail
-			// NOTE: This assumes that 2 spaces are used for indentation
 			c.InsertText = c.Label + post(1)
 			c.InsertTextMode = protocol.InsertTextModeAsIs
 		}
@@ -801,7 +841,7 @@ type option struct {
 func providedCompletions(
 	doc *document, keyPos protocol.Position, indentLevel int, options []option,
 ) (*protocol.CompletionList, error) {
-	sibs, err := childKeys(doc.text, keyPos)
+	sibs, err := childKeys(doc, keyPos)
 	if err != nil {
 		return nil, err
 	}
@@ -834,8 +874,10 @@ func providedCompletions(
 
 }
 
-func completeResourceOptionsKeys(doc *document, keyPos protocol.Position, post postFix) (*protocol.CompletionList, error) {
-	return providedCompletions(doc, keyPos, 4, []option{
+func completeResourceOptionsKeys(
+	doc *document, keyPos protocol.Position, post postFix, indentLevel int,
+) (*protocol.CompletionList, error) {
+	return providedCompletions(doc, keyPos, indentLevel, []option{
 		{"additionalSecretOutputs", "list<string>",
 			"AdditionalSecretOutputs specifies properties that must be encrypted as secrets", post.intoList},
 		{"aliases", "list<string>",
@@ -870,21 +912,23 @@ func completeResourceOptionsKeys(doc *document, keyPos protocol.Position, post p
 	})
 }
 
-func completePluginsKeys(doc *document, keyPos protocol.Position, post postFix) (*protocol.CompletionList, error) {
-	return providedCompletions(doc, keyPos, 2, []option{
+func completePluginsKeys(doc *document, keyPos protocol.Position, post postFix, indentLevel int) (*protocol.CompletionList, error) {
+	return providedCompletions(doc, keyPos, indentLevel, []option{
 		{"providers", "list<provider>", "Additional directives for the provider plugins used", post.intoList},
 	})
 }
 
-func completePluginProvidersKeys(doc *document, keyPos protocol.Position, post postFix) (*protocol.CompletionList, error) {
-	return providedCompletions(doc, keyPos, 4, []option{
+func completePluginProvidersKeys(
+	doc *document, keyPos protocol.Position, post postFix, indentLevel int,
+) (*protocol.CompletionList, error) {
+	return providedCompletions(doc, keyPos, indentLevel, []option{
 		{"name", "string", "The name of the provider.", post.sameLine},
 		{"path", "string", "The path to the folder that holds pulumi-resource-${NAME}b", post.sameLine},
 	})
 }
 
 func completeResourceKeys(doc *document, keyPos protocol.Position, postFix postFix) (*protocol.CompletionList, error) {
-	sibs, err := childKeys(doc.text, keyPos)
+	sibs, err := childKeys(doc, keyPos)
 	if err != nil {
 		return nil, err
 	}
@@ -924,6 +968,8 @@ func completeResourceKeys(doc *document, keyPos protocol.Position, postFix postF
 	addItem("properties", "A map of resource properties."+
 		" See https://www.pulumi.com/docs/intro/concepts/resources/ for details.", postFix.intoObject)
 	addItem("type", "The Pulumi type token for this resource.", postFix.sameLine)
+	addItem("get", "Read an existing resource instead of creating one."+
+		" See https://www.pulumi.com/docs/intro/concepts/resources/get/ for details.", postFix.intoObject)
 	addItem("options", "A map of resource options."+
 		" See https://www.pulumi.com/docs/intro/concepts/resources/options/ for details.", postFix.intoObject)
 
@@ -931,9 +977,42 @@ func completeResourceKeys(doc *document, keyPos protocol.Position, postFix postF
 }
 
 func completeResourcePropertyKeys(
-	c lsp.Client, doc *document, keyPos protocol.Position, s *server, postFix postFix,
+	c lsp.Client, doc *document, keyPos protocol.Position, s *server, postFix postFix, indentLevel int,
+) (*protocol.CompletionList, error) {
+	resource, err := resourceAtKey(c, doc, keyPos, s)
+	if err != nil || resource == nil {
+		return nil, err
+	}
+	existingProperties, err := childKeys(doc, keyPos)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeProperties(c, resource.InputProperties, util.MapKeys(existingProperties), postFix, indentLevel)
+}
+
+// completeResourceStateKeys completes the keys of `get.state` in a resource.
+// `keyPos` is the position of the `get` key, and `statePos` the position of its
+// `state` key.
+func completeResourceStateKeys(
+	c lsp.Client, doc *document, keyPos, statePos protocol.Position, s *server, postFix postFix, indentLevel int,
 ) (*protocol.CompletionList, error) {
-	sibs, ok, err := siblingKeys(doc.text, keyPos)
+	resource, err := resourceAtKey(c, doc, keyPos, s)
+	if err != nil || resource == nil {
+		return nil, err
+	}
+	existingProperties, err := childKeys(doc, statePos)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeProperties(c, bind.StateProperties(resource), util.MapKeys(existingProperties), postFix, indentLevel)
+}
+
+// resourceAtKey resolves the schema of the resource that declares the key at
+// `keyPos`, such as its `properties` or `get` key.
+func resourceAtKey(c lsp.Client, doc *document, keyPos protocol.Position, s *server) (*schema.Resource, error) {
+	sibs, ok, err := siblingKeys(doc, keyPos)
 	if !ok || err != nil {
 		return nil, err
 	}
@@ -943,42 +1022,33 @@ func completeResourcePropertyKeys(
 		return nil, nil
 	}
 
-	typ := getTokenAtLine(doc.text, int(typKey.Line))
+	typ := getTokenAtKey(doc, typKey)
 	if typ == "" {
 		c.LogDebugf("Completing resource properties: found malformed type on line: %q", typKey.Line)
 		return nil, nil
 	}
-	existingProperties, err := childKeys(doc.text, keyPos)
-	if err != nil {
-		return nil, err
-	}
 	var version string
 	if p, ok := sibs["options"]; ok {
-		v, ok, err := getNestedKey(doc.text, p, "version")
+		v, ok, err := getNestedKey(doc, p, "version")
 		if err != nil {
 			return nil, err
 		} else if ok {
-			s, err := extractVersionString(doc.text, v)
+			s, err := extractVersionString(doc, v)
 			if err != nil {
 				return nil, err
 			}
 			version = s
 		}
 	}
-	resource, err := resolveResource(c, s.schemas, typ, version)
-	if err != nil || resource == nil {
-		return nil, err
-	}
-
-	return s.completeProperties(c, resource.InputProperties, util.MapKeys(existingProperties), postFix, 4)
+	return resolveResource(c, s.schemas, typ, version)
 }
 
 // Walk a path of object keys, retrieving the position of the final key.
-func getNestedKey(text lsp.Document, pos protocol.Position, path ...string) (protocol.Position, bool, error) {
+func getNestedKey(doc *document, pos protocol.Position, path ...string) (protocol.Position, bool, error) {
 	if len(path) == 0 {
 		return pos, true, nil
 	}
-	m, err := childKeys(text, pos)
+	m, err := childKeys(doc, pos)
 	if err != nil {
 		return protocol.Position{}, false, err
 	}
@@ -986,20 +1056,23 @@ func getNestedKey(text lsp.Document, pos protocol.Position, path ...string) (pro
 	if !ok {
 		return protocol.Position{}, false, nil
 	}
-	return getNestedKey(text, d, path[1:]...)
+	return getNestedKey(doc, d, path[1:]...)
 }
 
 // Extract the version string from a line.
 //
 // If the string is empty, `"", nil` is a valid return value.
-func extractVersionString(text lsp.Document, pos protocol.Position) (string, error) {
-	line, err := text.Line(int(pos.Line))
+func extractVersionString(doc *document, pos protocol.Position) (string, error) {
+	if v, ok := scalarAtKey(doc, pos); ok {
+		return v, nil
+	}
+	line, err := doc.text.Line(int(pos.Line))
 	if err != nil {
 		return "", err
 	}
-	parts := strings.SplitN(line, ":", 1)
+	parts := strings.SplitN(line, ":", 2)
 	if len(parts) > 1 {
-		return strings.TrimSpace(parts[1]), nil
+		return strings.Trim(strings.TrimSpace(parts[1]), `"'`), nil
 	}
 	return "", nil
 }
@@ -1007,7 +1080,22 @@ func extractVersionString(text lsp.Document, pos protocol.Position) (string, err
 func completeFunctionArgumentKeys(
 	c lsp.Client, doc *document, invokePos, argumentsPos protocol.Position, s *server, postFix postFix, indentLevel int,
 ) (*protocol.CompletionList, error) {
-	keys, err := childKeys(doc.text, invokePos)
+	fn, err := functionAtKey(c, doc, invokePos, s)
+	if err != nil || fn == nil || fn.Inputs == nil {
+		return nil, err
+	}
+	existingProperties, err := childKeys(doc, argumentsPos)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeProperties(c, fn.Inputs.Properties, util.MapKeys(existingProperties), postFix, indentLevel)
+}
+
+// functionAtKey resolves the function called by the `fn::invoke` key at
+// `invokePos`. If the function is not given, nil is returned.
+func functionAtKey(c lsp.Client, doc *document, invokePos protocol.Position, s *server) (*schema.Function, error) {
+	keys, err := childKeys(doc, invokePos)
 	if err != nil {
 		return nil, err
 	}
@@ -1015,34 +1103,82 @@ func completeFunctionArgumentKeys(
 	if !ok {
 		return nil, nil
 	}
-	typ := getTokenAtLine(doc.text, int(fnKey.Line))
+	typ := getTokenAtKey(doc, fnKey)
 	if typ == "" {
 		return nil, nil
 	}
-	existingProperties, err := childKeys(doc.text, argumentsPos)
-	if err != nil {
-		return nil, err
-	}
 	var version string
-	if opts, ok := keys["option"]; ok {
-		v, ok, err := getNestedKey(doc.text, opts, "version")
+	if opts, ok := keys["options"]; ok {
+		v, ok, err := getNestedKey(doc, opts, "version")
 		if err != nil {
 			return nil, err
 		}
 		if ok {
-			s, err := extractVersionString(doc.text, v)
+			s, err := extractVersionString(doc, v)
 			if err != nil {
 				return nil, err
 			}
 			version = s
 		}
 	}
-	fn, err := resolveFunction(c, s.schemas, typ, version)
-	if err != nil || fn == nil || fn.Inputs == nil {
+	return resolveFunction(c, s.schemas, typ, version)
+}
+
+// Complete the `return` value of an invoke with the outputs of the invoked
+// function:
+//
+//	fn::invoke:
+//	  function: aws:ec2:getVpc
+//	  return: i
+func (s *server) completeInvokeReturn(c lsp.Client, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	pos := params.Position
+	line, err := doc.text.Line(int(pos.Line))
+	if err != nil {
 		return nil, err
 	}
+	item := strings.TrimLeft(line[:min(int(pos.Character), len(line))], " ")
+	if !strings.HasPrefix(item, "return:") {
+		return nil, nil
+	}
+	partial := strings.TrimLeft(strings.TrimLeft(strings.TrimPrefix(item, "return:"), " "), `"'`)
 
-	return s.completeProperties(c, fn.Inputs.Properties, util.MapKeys(existingProperties), postFix, indentLevel)
+	parents, _, ok, err := parentKeys(doc, pos)
+	if err != nil || !ok {
+		return nil, err
+	}
+	invoke := parents[len(parents)-1]
+	if strings.ToLower(invoke.B) != "fn::invoke" {
+		return nil, nil
+	}
+	fn, err := functionAtKey(c, doc, invoke.A, s)
+	if err != nil || fn == nil || fn.Outputs == nil {
+		return nil, err
+	}
+
+	replace := protocol.Range{
+		Start: protocol.Position{Line: pos.Line, Character: pos.Character - uint32(len(partial))},
+		End:   pos,
+	}
+	items := make([]protocol.CompletionItem, 0, len(fn.Outputs.Properties))
+	for _, prop := range fn.Outputs.Properties {
+		item := completionItemFromType(prop.Type)
+		item.Label = prop.Name
+		item.Deprecated = prop.DeprecationMessage != ""
+		item.Documentation = prop.Comment
+		item.FilterText = prop.Name
+		item.TextEdit = &protocol.TextEdit{Range: replace, NewText: prop.Name}
+		items = append(items, item)
+	}
+	return &protocol.CompletionList{Items: items}, nil
+}
+
+// getTokenAtKey returns the value of the key at `pos`, such as the resource type
+// of a `type` key.
+func getTokenAtKey(doc *document, pos protocol.Position) string {
+	if v, ok := scalarAtKey(doc, pos); ok {
+		return v
+	}
+	return getTokenAtLine(doc.text, int(pos.Line))
 }
 
 // Fetch the token on a line such as
@@ -1084,7 +1220,7 @@ func (s *server) completeProperties(
 	}
 	for i, p := range completions.Items {
 		f := postFix.sameLine
-		switch codegen.UnwrapType(props[i].Type).(type) {
+		switch bind.UnwrapType(props[i].Type).(type) {
 		case *schema.ArrayType:
 			f = postFix.intoList
 		case *schema.MapType, *schema.ObjectType:
@@ -1098,7 +1234,10 @@ func (s *server) completeProperties(
 }
 
 type postFix struct {
+	// The number of spaces in each level of indentation.
 	indentation int
+	// Keys in flow maps are followed by their value on the same line.
+	flow bool
 }
 
 func (p postFix) sameLine(ignored int) string {
@@ -1106,9 +1245,103 @@ func (p postFix) sameLine(ignored int) string {
 }
 
 func (p postFix) intoObject(indentationLevel int) string {
+	if p.flow {
+		return ": "
+	}
 	return ":\n" + strings.Repeat(" ", p.indentation*indentationLevel)
 }
 
 func (p postFix) intoList(indentationLevel int) string {
+	if p.flow {
+		return ": "
+	}
 	return p.intoObject(indentationLevel) + "- "
 }
+
+// The resource options whose values are lists of property paths.
+var propertyPathOptions = util.NewSet("ignorechanges", "replaceonchanges", "additionalsecretoutputs")
+
+// completePropertyPath completes the property paths listed by the
+// `ignoreChanges`, `replaceOnChanges` and `additionalSecretOutputs` options of a
+// resource, from the resource's schema. Nested paths such as `a.b[0].c` are
+// completed one property at a time.
+func (s *server) completePropertyPath(c lsp.Client, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	pos := params.Position
+	line, err := doc.text.Line(int(pos.Line))
+	if err != nil {
+		return nil, err
+	}
+	item := strings.TrimLeft(line[:min(int(pos.Character), len(line))], " ")
+	if !strings.HasPrefix(item, "-") {
+		return nil, nil
+	}
+	path := strings.TrimLeft(strings.TrimLeft(strings.TrimPrefix(item, "-"), " "), `"'`)
+
+	parents, _, ok, err := parentKeys(doc, pos)
+	if err != nil || !ok || len(parents) != 4 {
+		return nil, err
+	}
+	option := parents[3].B
+	if strings.ToLower(parents[0].B) != "resources" || strings.ToLower(parents[2].B) != "options" ||
+		!propertyPathOptions.Has(strings.ToLower(option)) {
+		return nil, nil
+	}
+
+	keys, err := childKeys(doc, parents[1].A)
+	if err != nil {
+		return nil, err
+	}
+	typKey, ok := keys["type"]
+	if !ok {
+		return nil, nil
+	}
+	typ := getTokenAtKey(doc, typKey)
+	if typ == "" {
+		return nil, nil
+	}
+	var version string
+	if v, ok, err := getNestedKey(doc, parents[2].A, "version"); err != nil {
+		return nil, err
+	} else if ok {
+		if version, err = extractVersionString(doc, v); err != nil {
+			return nil, err
+		}
+	}
+	resource, err := resolveResource(c, s.schemas, typ, version)
+	if err != nil || resource == nil {
+		return nil, err
+	}
+
+	// Find the type of the property being drilled into.
+	t := bind.PropertyPathRoot(option, resource)
+	partial := path
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		if path[i] == '[' {
+			// We don't complete indexes.
+			return nil, nil
+		}
+		accessors, ok := bind.ParsePropertyPath(path[:i], nil)
+		if !ok {
+			return nil, nil
+		}
+		types, diag := accessors.TypeFromRoot(t)
+		if diag != nil || len(types) != len(accessors)+1 {
+			return nil, nil
+		}
+		t, partial = types[len(types)-1], path[i+1:]
+	}
+	list, err := s.typePropertyCompletion(t, "")
+	if err != nil || list == nil {
+		return list, err
+	}
+	replace := protocol.Range{
+		Start: protocol.Position{Line: pos.Line, Character: pos.Character - uint32(len(partial))},
+		End:   pos,
+	}
+	for i, item := range list.Items {
+		item.FilterText = item.Label
+		item.TextEdit = &protocol.TextEdit{Range: replace, NewText: item.Label}
+		list.Items[i] = item
+	}
+	return list, nil
+}
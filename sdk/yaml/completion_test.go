@@ -0,0 +1,383 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
+)
+
+func TestCompletePropertyPath(t *testing.T) {
+	s := &server{
+		docs:    map[protocol.DocumentURI]*document{},
+		schemas: testutil.Loader(testutil.Package()),
+	}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  res:
+    type: test:index:Resource
+    options:
+      ignoreChanges:
+        - rules[0].p
+        - na
+      additionalSecretOutputs:
+        - a
+`,
+	})
+	doc := &document{text: text, server: s}
+	complete := func(line, char uint32) []string {
+		list, err := s.completePropertyPath(lsp.Client{}, doc, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				Position: protocol.Position{Line: line, Character: char},
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, list)
+		labels := []string{}
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+			assert.Equal(t, protocol.Position{Line: line, Character: char}, item.TextEdit.Range.End)
+		}
+		return labels
+	}
+
+	assert.ElementsMatch(t, []string{"host", "port"}, complete(5, 20))
+	assert.ElementsMatch(t, []string{"name", "rules", "tags"}, complete(6, 12))
+	assert.ElementsMatch(t, []string{"arn"}, complete(8, 11))
+}
+
+func TestCompleteResourceRead(t *testing.T) {
+	s := &server{
+		docs:    map[protocol.DocumentURI]*document{},
+		schemas: testutil.Loader(testutil.Package()),
+	}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  res:
+    type: test:index:Resource
+    get:
+      id: some-id
+      state:
+        a
+`,
+	})
+	doc := &document{text: text, server: s}
+	list, err := s.completeKey(lsp.Client{}, doc, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			Position: protocol.Position{Line: 6, Character: 9},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, list)
+	labels := []string{}
+	for _, item := range list.Items {
+		labels = append(labels, item.Label)
+	}
+	// The resource declares no state inputs, so its outputs are used.
+	assert.Equal(t, []string{"arn"}, labels)
+}
+
+func TestCompleteFilePath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "site"), 0o700))
+	for _, f := range []string{"index.html", "site/main.css", ".env"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o600))
+	}
+	s := &server{docs: map[protocol.DocumentURI]*document{}}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: uri.File(filepath.Join(dir, "Pulumi.yaml")),
+		Text: `variables:
+  page:
+    fn::readFile: ./
+  css:
+    fn::fileAsset: "${pulumi.cwd}/site/m
+  hidden:
+    fn::readFile: .e
+  other:
+    fn::join: site/
+`,
+	})
+	doc := &document{text: text, server: s}
+	complete := func(line, char uint32) []string {
+		list, err := s.completeFilePath(lsp.Client{}, doc, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				Position: protocol.Position{Line: line, Character: char},
+			},
+		})
+		require.NoError(t, err)
+		if list == nil {
+			return nil
+		}
+		labels := []string{}
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+			assert.Equal(t, protocol.Position{Line: line, Character: char}, item.TextEdit.Range.End)
+		}
+		return labels
+	}
+
+	assert.ElementsMatch(t, []string{"index.html", "site/"}, complete(2, 20))
+	assert.ElementsMatch(t, []string{"main.css"}, complete(4, 40))
+	assert.ElementsMatch(t, []string{".env"}, complete(6, 20))
+	assert.Nil(t, complete(8, 19))
+}
+
+func TestCompletionItemFromUnion(t *testing.T) {
+	union := &schema.UnionType{ElementTypes: []schema.Type{schema.StringType, schema.NumberType}}
+	assert.Equal(t, "string | number", completionItemFromType(union).Detail)
+	assert.Equal(t, "", completionItemFromType(&schema.UnionType{}).Detail)
+}
+
+func TestExtractVersionStringFromLine(t *testing.T) {
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{
+		URI:  "file:///Pulumi.yaml",
+		Text: "options:\n  version: \"1.2.3\"\n",
+	})}
+	// The position is past the key, so the version is read from the line.
+	v, err := extractVersionString(doc, protocol.Position{Line: 1, Character: 12})
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", v)
+}
+
+// A schema.ReferenceLoader that records the versions it is asked to load.
+type versionRecorder struct {
+	testutil.SpecLoader
+
+	versions []string
+}
+
+func (l *versionRecorder) LoadPackageReferenceV2(
+	ctx context.Context, d *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	version := ""
+	if d.Version != nil {
+		version = d.Version.String()
+	}
+	l.versions = append(l.versions, version)
+	return l.SpecLoader.LoadPackageReferenceV2(ctx, d)
+}
+
+func TestFunctionAtKeyVersion(t *testing.T) {
+	loader := &versionRecorder{SpecLoader: testutil.Loader(testutil.Package())}
+	s := &server{docs: map[protocol.DocumentURI]*document{}, schemas: loader}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `variables:
+  thing:
+    fn::invoke:
+      function: test:index:getThing
+      options:
+        version: 1.2.3
+`,
+	})
+	doc := &document{text: text, server: s}
+	fn, err := functionAtKey(lsp.Client{}, doc, protocol.Position{Line: 2, Character: 4}, s)
+	require.NoError(t, err)
+	require.NotNil(t, fn)
+	assert.Equal(t, "test:index:getThing", fn.Token)
+	assert.Equal(t, []string{"1.2.3"}, loader.versions)
+}
+
+func TestCompleteInvokeReturn(t *testing.T) {
+	s := &server{
+		docs:    map[protocol.DocumentURI]*document{},
+		schemas: testutil.Loader(testutil.Package()),
+	}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `variables:
+  thing:
+    fn::invoke:
+      function: test:index:getThing
+      return: i
+`,
+	})
+	doc := &document{text: text, server: s}
+	list, err := s.completeInvokeReturn(lsp.Client{}, doc, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			Position: protocol.Position{Line: 4, Character: 15},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, list)
+	labels := []string{}
+	for _, item := range list.Items {
+		labels = append(labels, item.Label)
+		assert.Equal(t, protocol.Range{
+			Start: protocol.Position{Line: 4, Character: 14},
+			End:   protocol.Position{Line: 4, Character: 15},
+		}, item.TextEdit.Range)
+	}
+	assert.ElementsMatch(t, []string{"id", "rule"}, labels)
+}
+
+func TestCompleteVersion(t *testing.T) {
+	s := &server{
+		docs: map[protocol.DocumentURI]*document{},
+		plugins: newPluginCache(func() (map[string][]semver.Version, error) {
+			return map[string][]semver.Version{
+				"test": {semver.MustParse("2.0.0"), semver.MustParse("1.10.0"), semver.MustParse("1.2.0")},
+			}, nil
+		}),
+	}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  res:
+    type: test:index:Resource
+    options:
+      version: 1.
+  provider:
+    type: pulumi:providers:test
+    options:
+      version: "
+variables:
+  thing:
+    fn::invoke:
+      function: test:index:getThing
+      options:
+        version: 
+`,
+	})
+	doc := &document{text: text, server: s}
+	complete := func(line, char uint32) []string {
+		list, err := s.completeVersion(lsp.Client{}, doc, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				Position: protocol.Position{Line: line, Character: char},
+			},
+		})
+		require.NoError(t, err)
+		if list == nil {
+			return nil
+		}
+		labels := []string{}
+		for i, item := range list.Items {
+			labels = append(labels, item.Label)
+			if i > 0 {
+				assert.Less(t, list.Items[i-1].SortText, item.SortText)
+			}
+			assert.Equal(t, protocol.Position{Line: line, Character: char}, item.TextEdit.Range.End)
+		}
+		return labels
+	}
+
+	all := []string{"2.0.0", "1.10.0", "1.2.0"}
+	assert.Equal(t, all, complete(4, 17))
+	assert.Equal(t, all, complete(8, 16))
+	assert.Equal(t, all, complete(14, 17))
+	assert.Nil(t, complete(2, 10))
+}
+
+func TestPluginCache(t *testing.T) {
+	listed := 0
+	plugins := newPluginCache(func() (map[string][]semver.Version, error) {
+		listed++
+		return map[string][]semver.Version{"test": {semver.MustParse("1.0.0")}}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		versions, err := plugins.get()
+		require.NoError(t, err)
+		assert.Len(t, versions["test"], 1)
+	}
+	assert.Equal(t, 1, listed, "analyses should share one listing")
+
+	_, err := plugins.refresh()
+	require.NoError(t, err)
+	assert.Equal(t, 2, listed, "completing a version should list the plugins again")
+
+	plugins.listed = plugins.listed.Add(-installedPluginsTTL)
+	_, err = plugins.get()
+	require.NoError(t, err)
+	assert.Equal(t, 3, listed, "a stale listing should be replaced")
+}
+
+func TestCompleteFlowMapKey(t *testing.T) {
+	s := &server{
+		docs:    map[protocol.DocumentURI]*document{},
+		schemas: testutil.Loader(testutil.Package()),
+	}
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  res: {type: test:index:Resource, properties: { name: foo, r }}
+`,
+	})
+	doc := &document{text: text, server: s}
+	complete := func(char uint32) []string {
+		list, err := s.completeKey(lsp.Client{}, doc, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				Position: protocol.Position{Line: 1, Character: char},
+			},
+		})
+		require.NoError(t, err)
+		if list == nil {
+			return nil
+		}
+		items := []string{}
+		for _, item := range list.Items {
+			items = append(items, item.InsertText)
+		}
+		return items
+	}
+
+	// Values in flow maps stay on the same line.
+	assert.ElementsMatch(t, []string{"rules: ", "tags: "}, complete(61))
+	// The cursor is on a value, not a key.
+	assert.Nil(t, complete(56))
+}
+
+func TestCompleteIndentation(t *testing.T) {
+	s := &server{
+		docs:    map[protocol.DocumentURI]*document{},
+		schemas: testutil.Loader(testutil.Package()),
+	}
+	complete := func(text string, pos protocol.Position) map[string]string {
+		doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{URI: "file:///Pulumi.yaml", Text: text}), server: s}
+		list, err := s.completeKey(lsp.Client{}, doc, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{Position: pos},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, list)
+		items := map[string]string{}
+		for _, item := range list.Items {
+			items[item.Label] = item.InsertText
+		}
+		return items
+	}
+
+	// Nested blocks follow the document's indentation.
+	items := complete(`resources:
+    res:
+        type: test:index:Resource
+        properties:
+            r
+`, protocol.Position{Line: 4, Character: 13})
+	assert.Equal(t, "rules:\n"+strings.Repeat(" ", 16)+"- ", items["rules"])
+	items = complete(`resources:
+    res:
+        type: test:index:Resource
+r
+`, protocol.Position{Line: 3, Character: 1})
+	assert.Equal(t, "outputs:\n    ", items["outputs"])
+
+	// Without nested blocks, the client's tab size is used.
+	s.tabSize = 3
+	items = complete("name: project\nr\n", protocol.Position{Line: 1, Character: 1})
+	assert.Equal(t, "resources:\n   ", items["resources"])
+}
@@ -9,10 +9,12 @@ import (
 
 	"go.lsp.dev/protocol"
 
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
 	"github.com/pulumi/pulumi/pkg/v3/codegen"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
 
+	"github.com/pulumi/pulumi-lsp/sdk/util"
 	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
 )
 
@@ -34,11 +36,47 @@ type Object interface {
 
 type Reference struct {
 	object
-	ref *bind.Reference
+	ref  *bind.Reference
+	decl *bind.Decl
 }
 
 func (r *Reference) Describe() (protocol.MarkupContent, bool) {
-	return protocol.MarkupContent{}, false
+	if r.ref == nil || r.ref.Var() == nil || r.ref.Var().Source() == nil {
+		return protocol.MarkupContent{}, false
+	}
+	source := r.ref.Var().Source()
+	b := &bytes.Buffer{}
+	if accessors := r.ref.Accessors(); len(accessors) > 0 {
+		// Describe the property being accessed, such as `${vpc.id}` when `vpc`
+		// holds the result of an invoke.
+		root := source.ResolveType(r.decl)
+		if root == nil {
+			return protocol.MarkupContent{}, false
+		}
+		prop, ok := accessors.PropertyFromRoot(root)
+		if !ok {
+			return protocol.MarkupContent{}, false
+		}
+		if bind.IsSecret(root) && !prop.Secret {
+			// Properties read from a secret are secret too.
+			secret := *prop
+			secret.Secret = true
+			prop = &secret
+		}
+		writeAccessedProperty(b, util.Tuple[string, *schema.Property]{A: r.ref.String(), B: prop})
+	} else if config, ok := source.(*bind.ConfigMapEntry); ok {
+		writeConfig(b, util.Tuple[string, *bind.ConfigMapEntry]{A: r.ref.Var().Name(), B: config})
+	} else {
+		typ := source.ResolveType(r.decl)
+		if typ == nil {
+			return protocol.MarkupContent{}, false
+		}
+		writeVariable(b, util.Tuple[string, schema.Type]{A: r.ref.Var().Name(), B: typ})
+	}
+	return protocol.MarkupContent{
+		Kind:  protocol.Markdown,
+		Value: b.String(),
+	}, true
 }
 
 type Resource struct {
@@ -76,6 +114,37 @@ func (f Invoke) Describe() (protocol.MarkupContent, bool) {
 	}, true
 }
 
+// A key in the `customTimeouts` resource option.
+type CustomTimeout struct {
+	object
+	// The operation the timeout applies to: create, update or delete.
+	operation string
+}
+
+// The documentation of each custom timeout, keyed by the operation it applies
+// to.
+var customTimeoutDocs = map[string]string{
+	"create": "The maximum time to wait for the resource to be created.",
+	"update": "The maximum time to wait for the resource to be updated.",
+	"delete": "The maximum time to wait for the resource to be deleted.",
+}
+
+func (t CustomTimeout) Describe() (protocol.MarkupContent, bool) {
+	doc, ok := customTimeoutDocs[t.operation]
+	if !ok {
+		return protocol.MarkupContent{}, false
+	}
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "# Custom Timeout: %s\n\n%s\n\n", t.operation, doc)
+	fmt.Fprintf(b, "If the operation takes longer, it fails. The timeout is a duration such as `10m` or `1h30m`; "+
+		"valid units are `ns`, `us`, `ms`, `s`, `m` and `h`. If no timeout is given, the provider's default is used. "+
+		"Not every provider supports custom timeouts.\n")
+	return protocol.MarkupContent{
+		Kind:  protocol.Markdown,
+		Value: b.String(),
+	}, true
+}
+
 type Writer = func(msg string, args ...interface{})
 
 func MakeIOWriter[T any](f func(Writer, T)) func(io.Writer, T) {
@@ -127,6 +196,33 @@ var writeResource = MakeIOWriter(func(w Writer, r *schema.Resource) {
 	}
 })
 
+var writeConfig = MakeIOWriter(func(w Writer, c util.Tuple[string, *bind.ConfigMapEntry]) {
+	w("# Config: %s\n", c.A)
+	if typ := c.B.ResolveType(nil); typ != nil {
+		w("**Type:** `%s`\n\n", diags.DisplayType(typ))
+	}
+	if c.B.IsSecret() {
+		w("This value is secret.\n")
+	}
+})
+
+var writeVariable = MakeIOWriter(func(w Writer, v util.Tuple[string, schema.Type]) {
+	w("# Variable: %s\n", v.A)
+	w("**Type:** `%s`\n", diags.DisplayType(v.B))
+})
+
+var writeAccessedProperty = MakeIOWriter(func(w Writer, p util.Tuple[string, *schema.Property]) {
+	w("# Property: %s\n", p.A)
+	w("**Type:** `%s`\n\n", diags.DisplayType(p.B.Type))
+	if p.B.Secret {
+		w("This value is secret.\n\n")
+	}
+	if p.B.DeprecationMessage != "" {
+		w("## Depreciated\n%s\n", p.B.DeprecationMessage)
+	}
+	w("%s\n", p.B.Comment)
+})
+
 func writePropertyDescription(w Writer, prop *schema.Property) {
 	w("### %s\n", prop.Name)
 	w("**Type:** `%s`\n\n", codegen.UnwrapType(prop.Type))
@@ -0,0 +1,126 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+)
+
+// The builtins that take the path of a local file.
+var fileBuiltins = []string{"fn::readFile", "fn::fileAsset", "fn::fileArchive"}
+
+// The prefix of paths that are explicitly relative to the project directory.
+const cwdPrefix = "${pulumi.cwd}"
+
+// Complete the path given to a file builtin, such as
+//
+//	fn::readFile: ./src/ma
+//
+// Paths are relative to the project directory.
+func (s *server) completeFilePath(c lsp.Client, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	pos := params.Position
+	line, err := doc.text.Line(int(pos.Line))
+	if err != nil {
+		return nil, err
+	}
+	item := strings.TrimLeft(line[:min(int(pos.Character), len(line))], " ")
+	item = strings.TrimLeft(strings.TrimPrefix(item, "-"), " ")
+	var builtin string
+	for _, b := range fileBuiltins {
+		if strings.HasPrefix(item, b+":") {
+			builtin = b
+			break
+		}
+	}
+	if builtin == "" {
+		return nil, nil
+	}
+	path := strings.TrimLeft(strings.TrimLeft(strings.TrimPrefix(item, builtin+":"), " "), `"'`)
+
+	projectDir := filepath.Dir(doc.text.URI().Filename())
+	resolved := path
+	if strings.HasPrefix(path, cwdPrefix) {
+		resolved = projectDir + strings.TrimPrefix(path, cwdPrefix)
+	}
+	if strings.Contains(resolved, "${") {
+		// The path depends on other values.
+		return nil, nil
+	}
+	dir, partial := "", resolved
+	if i := strings.LastIndex(resolved, "/"); i >= 0 {
+		dir, partial = resolved[:i+1], resolved[i+1:]
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(projectDir, dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		c.LogInfof("Could not complete path %q: %s", path, err.Error())
+		return nil, nil
+	}
+
+	replace := protocol.Range{
+		Start: protocol.Position{Line: pos.Line, Character: pos.Character - uint32(len(partial))},
+		End:   pos,
+	}
+	items := []protocol.CompletionItem{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, partial) ||
+			// Hidden files are only completed when asked for.
+			strings.HasPrefix(name, ".") && !strings.HasPrefix(partial, ".") {
+			continue
+		}
+		kind := protocol.CompletionItemKindFile
+		if entry.IsDir() {
+			kind = protocol.CompletionItemKindFolder
+			name += "/"
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:      name,
+			Kind:       kind,
+			FilterText: name,
+			TextEdit:   &protocol.TextEdit{Range: replace, NewText: name},
+		})
+	}
+	return &protocol.CompletionList{Items: items}, nil
+}
+
+// Link the paths given to file builtins to the files they refer to.
+func (s *server) documentLink(client lsp.Client, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	doc, ok := s.getDocument(params.TextDocument.URI)
+	if !ok {
+		return nil, fmt.Errorf("could not find an opened document %s", params.TextDocument.URI.Filename())
+	}
+	if doc.analysis == nil {
+		// Stack files don't reference files.
+		return nil, nil
+	}
+	bound, ok := doc.analysis.bound.GetResultContext(client.Context())
+	if !ok || bound.A == nil {
+		return nil, nil
+	}
+	links := []protocol.DocumentLink{}
+	for _, f := range bound.A.FilePaths() {
+		rnge, ok := syntaxRange(f.Expr)
+		if !ok || f.Path == "" {
+			continue
+		}
+		if info, err := os.Stat(f.Path); err != nil || info.IsDir() {
+			continue
+		}
+		links = append(links, protocol.DocumentLink{
+			Range:  convertRange(rnge),
+			Target: uri.File(f.Path),
+		})
+	}
+	return links, nil
+}
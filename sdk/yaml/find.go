@@ -3,6 +3,7 @@
 package yaml
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -28,8 +29,11 @@ func (e UnparsableError) Error() string {
 // Find the object at point, as well as it's location. An error indicates that
 // there was a problem getting the object at point. If no object is found, all
 // zero values are returned.
-func (doc *document) objectAtPoint(pos protocol.Position) (Object, error) {
-	parsed, ok := doc.analysis.parsed.GetResult()
+//
+// If `ctx` is canceled while waiting on the analysis, an UnparsableError is
+// returned.
+func (doc *document) objectAtPoint(ctx context.Context, pos protocol.Position) (Object, error) {
+	parsed, ok := doc.analysis.parsed.GetResultContext(ctx)
 	canceledErr := UnparsableError{"canceled", true}
 	nilError := UnparsableError{"failed", false}
 	if !ok {
@@ -38,68 +42,48 @@ func (doc *document) objectAtPoint(pos protocol.Position) (Object, error) {
 	if parsed.A == nil {
 		return nil, nilError
 	}
-	for _, r := range parsed.A.Resources.Entries {
-		keyRange := r.Key.Syntax().Syntax().Range()
-		if r.Value != nil && r.Value.Type != nil && posInRange(r.Value.Type.Syntax().Syntax().Range(), pos) {
-			tk := r.Value.Type.Value
-			bound, ok := doc.analysis.bound.GetResult()
-			if !ok {
-				return nil, canceledErr
-			}
-			if bound.A == nil {
-				return nil, nilError
-			}
-			version := ""
-			if v := r.Value.Options.Version; v != nil {
-				version = v.Value
-			}
-			res, err := bound.A.GetResources(tk, version)
-			if err != nil {
-				return nil, err
-			}
-			if len(res) == 0 {
-				return nil, nil
-			}
-			valueRange := r.Value.Syntax().Syntax().Range()
-			return Resource{
-				object: object{combineRange(convertRange(keyRange), convertRange(valueRange))},
-				schema: res[0].Schema(),
-			}, nil
-		}
-	}
-	bound, ok := doc.analysis.bound.GetResult()
+	index, ok := doc.analysis.index.GetResultContext(ctx)
 	if !ok {
 		return nil, canceledErr
 	}
-	if bound.A == nil {
+	if index == nil {
 		return nil, nilError
 	}
+	return index.at(pos)
+}
 
-	for _, f := range bound.A.Invokes() {
-		tk := f.Expr().Token
-		if posInRange(tk.Syntax().Syntax().Range(), pos) {
-			return Invoke{
-				object: object{convertRange(f.Expr().Syntax().Syntax().Range())},
-				schema: f.Schema(),
-			}, nil
-		}
-	}
+type KeyPos = util.Tuple[protocol.Position, string]
 
-	for _, r := range bound.A.References() {
-		if posInRange(r.Range(), pos) {
-			return &Reference{
-				object: object{convertRange(r.Range())},
-				ref:    &r,
-			}, nil
+// Return the place where the enclosing object starts
+func enclosingKey(doc *document, pos protocol.Position) (protocol.Position, int, bool, error) {
+	line, err := doc.text.Line(int(pos.Line))
+	if err != nil {
+		return protocol.Position{}, 0, false, err
+	}
+	tree := doc.keyTree()
+	if tree == nil {
+		return enclosingKeyByIndentation(doc.text, pos)
+	}
+	chain := tree.enclosing(pos)
+	if len(chain) == 0 {
+		return protocol.Position{}, 0, false, nil
+	}
+	parent := chain[len(chain)-1]
+	indentation, _ := indentationLevel(line)
+	indentation -= tree.lineIndentation(parent.key)
+	if indentation <= 0 {
+		// Keys in flow maps can share a line with their parent.
+		indentation = defaultIndentation
+		if n, ok := documentIndentation(doc.text); ok {
+			indentation = n
 		}
 	}
-	return nil, nil
+	return parent.key, indentation, true, nil
 }
 
-type KeyPos = util.Tuple[protocol.Position, string]
-
-// Return the place where the enclosing object starts
-func enclosingKey(text lsp.Document, pos protocol.Position) (protocol.Position, int, bool, error) {
+// enclosingKeyByIndentation finds the enclosing key by scanning lines. It is
+// used when the document is not valid YAML, which is common while editing.
+func enclosingKeyByIndentation(text lsp.Document, pos protocol.Position) (protocol.Position, int, bool, error) {
 	lineNum := int(pos.Line)
 	line, err := text.Line(lineNum)
 	if err != nil {
@@ -108,7 +92,7 @@ func enclosingKey(text lsp.Document, pos protocol.Position) (protocol.Position,
 	indentation, _ := indentationLevel(line)
 	// Scan up until a non-blank line with less indentation is found. This
 	// assumes that the YAML is valid and not in flow form.
-	for lineNum > 1 {
+	for lineNum > 0 {
 		lineNum--
 		line, err := text.Line(lineNum)
 		if err != nil {
@@ -128,19 +112,30 @@ func enclosingKey(text lsp.Document, pos protocol.Position) (protocol.Position,
 }
 
 // Return the chain of parent keys from most senior to least senior.
-func parentKeys(text lsp.Document, pos protocol.Position) ([]KeyPos, int, bool, error) {
-	parent, ind, ok, err := enclosingKey(text, pos)
+func parentKeys(doc *document, pos protocol.Position) ([]KeyPos, int, bool, error) {
+	parent, ind, ok, err := enclosingKey(doc, pos)
 	if err != nil || !ok {
 		return nil, ind, ok, err
 	}
-	key, err := text.Line(int(parent.Line))
+	if tree := doc.keyTree(); tree != nil {
+		chain := tree.enclosing(pos)
+		keys := make([]KeyPos, len(chain))
+		for i, e := range chain {
+			keys[i] = KeyPos{A: e.key, B: e.name}
+		}
+		if len(keys) == 1 {
+			ind = 0
+		}
+		return keys, ind, true, nil
+	}
+	key, err := doc.text.Line(int(parent.Line))
 	if err != nil {
 		return nil, 0, false, err
 	}
 	key = strings.TrimSpace(key)
 	key = strings.TrimSuffix(key, ":")
 
-	grandparents, _, ok, err := parentKeys(text, parent)
+	grandparents, _, ok, err := parentKeys(doc, parent)
 	if err != nil {
 		return nil, 0, false, err
 	}
@@ -163,8 +158,64 @@ func indentationLevel(line string) (spaces int, allBlank bool) {
 	return level, strings.TrimSpace(line) == ""
 }
 
+// documentIndentation detects the number of spaces the document indents nested
+// blocks by. It is the most common step in indentation between a line and the
+// line that opens its block. Steps after list dashes and lines in multi-line
+// strings are not counted.
+func documentIndentation(text lsp.Document) (int, bool) {
+	steps := map[int]int{}
+	prev, prevItem := 0, false
+	inString, stringIndent := false, 0
+	for i := 0; i < text.LineLen(); i++ {
+		line, err := text.Line(i)
+		if err != nil {
+			return 0, false
+		}
+		ind, blank := indentationLevel(line)
+		trimmed := strings.TrimSpace(line)
+		if blank || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if inString {
+			if ind > stringIndent {
+				continue
+			}
+			inString = false
+		}
+		if ind > prev && !prevItem {
+			steps[ind-prev]++
+		}
+		prev, prevItem = ind, strings.HasPrefix(trimmed, "-")
+		if value := strings.TrimRight(trimmed, "+-0123456789"); strings.HasSuffix(value, "|") || strings.HasSuffix(value, ">") {
+			inString, stringIndent = true, ind
+		}
+	}
+	best := 0
+	for step, count := range steps {
+		if best == 0 || count > steps[best] || count == steps[best] && step < best {
+			best = step
+		}
+	}
+	return best, best > 0
+}
+
 // childKeys returns a map of subsidiary keys to their positions.
-func childKeys(text lsp.Document, pos protocol.Position) (map[string]protocol.Position, error) {
+func childKeys(doc *document, pos protocol.Position) (map[string]protocol.Position, error) {
+	if tree := doc.keyTree(); tree != nil {
+		if e, ok := tree.entryAt(pos); ok {
+			m := map[string]protocol.Position{}
+			for _, child := range e.children() {
+				m[strings.ToLower(child.name)] = child.key
+			}
+			return m, nil
+		}
+	}
+	return childKeysByIndentation(doc.text, pos)
+}
+
+// childKeysByIndentation finds subsidiary keys by scanning lines, for documents
+// that are not valid YAML.
+func childKeysByIndentation(text lsp.Document, pos protocol.Position) (map[string]protocol.Position, error) {
 	line, err := text.Line(int(pos.Line))
 	if err != nil {
 		return nil, err
@@ -214,23 +265,30 @@ func childKeys(text lsp.Document, pos protocol.Position) (map[string]protocol.Po
 }
 
 // siblingKeys returns list of properties at the level of `pos`.
-func siblingKeys(text lsp.Document, pos protocol.Position) (map[string]protocol.Position, bool, error) {
-	parent, _, ok, err := enclosingKey(text, pos)
+func siblingKeys(doc *document, pos protocol.Position) (map[string]protocol.Position, bool, error) {
+	parent, _, ok, err := enclosingKey(doc, pos)
 	if err != nil || !ok {
 		return nil, ok, err
 	}
-	siblings, err := childKeys(text, parent)
+	siblings, err := childKeys(doc, parent)
 	if err != nil {
 		return nil, false, err
 	}
 	return siblings, true, nil
 }
 
-// topLevelKeys returns the top level YAML keys in `text`. The parse is line by line.
-func topLevelKeys(text lsp.Document) (map[string]protocol.Position, error) {
+// topLevelKeys returns the top level YAML keys in `doc`. If the document is
+// not valid YAML, the parse is line by line.
+func topLevelKeys(doc *document) (map[string]protocol.Position, error) {
 	m := map[string]protocol.Position{}
-	for i := 0; i < text.LineLen(); i++ {
-		line, err := text.Line(i)
+	if tree := doc.keyTree(); tree != nil {
+		for _, e := range tree.root.entries {
+			m[e.name] = e.key
+		}
+		return m, nil
+	}
+	for i := 0; i < doc.text.LineLen(); i++ {
+		line, err := doc.text.Line(i)
 		if err != nil {
 			return nil, err
 		}
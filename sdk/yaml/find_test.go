@@ -2,9 +2,18 @@
 package yaml
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
 )
 
 func TestIndentation(t *testing.T) {
@@ -12,3 +21,314 @@ func TestIndentation(t *testing.T) {
 	assert.Equal(t, 4, s)
 	assert.False(t, blank)
 }
+
+func TestCustomTimeoutAtPoint(t *testing.T) {
+	template, diags, err := yaml.LoadYAML("test.yaml", strings.NewReader(`resources:
+  res:
+    type: test:index:Resource
+    options:
+      customTimeouts:
+        create: 10m
+`))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	index := buildObjectIndex(template, decl)
+
+	o, err := index.at(protocol.Position{Line: 5, Character: 10})
+	require.NoError(t, err)
+	require.IsType(t, CustomTimeout{}, o)
+	description, ok := o.Describe()
+	require.True(t, ok)
+	assert.Contains(t, description.Value, "# Custom Timeout: create")
+
+	o, err = index.at(protocol.Position{Line: 4, Character: 8})
+	require.NoError(t, err)
+	_, isTimeout := o.(CustomTimeout)
+	assert.False(t, isTimeout)
+}
+
+func TestDescribeInvokeResult(t *testing.T) {
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(`variables:
+  thing:
+    fn::invoke:
+      function: test:index:getThing
+outputs:
+  id: ${thing.id}
+  port: ${thing.rule.port}
+  thing: ${thing}
+`))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), testutil.Loader(testutil.Package()))
+	assert.Empty(t, decl.Diags())
+
+	describe := func(ref string) string {
+		for _, r := range decl.References() {
+			if r.String() == ref {
+				r := r
+				description, ok := (&Reference{ref: &r, decl: decl}).Describe()
+				require.True(t, ok)
+				return description.Value
+			}
+		}
+		require.Failf(t, "missing reference", "no reference to %s", ref)
+		return ""
+	}
+	assert.Equal(t, "# Property: thing.id\n**Type:** `string`\n\nThe ID of the thing.\n", describe("thing.id"))
+	assert.Equal(t, "# Property: thing.rule.port\n**Type:** `integer`\n\nThe port to use.\n", describe("thing.rule.port"))
+	assert.Contains(t, describe("thing"), "# Variable: thing\n")
+}
+
+func TestDescribeSecret(t *testing.T) {
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(`resources:
+  db:
+    type: test:index:Database
+variables:
+  settings:
+    fn::secret:
+      port: 80
+outputs:
+  settings:
+    fn::secret: ["${settings}", "${settings.port}", "${db.connectionString}"]
+`))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	decl.LoadSchema(context.Background(), testutil.Loader(testutil.Package()))
+	assert.Empty(t, decl.Diags())
+
+	describe := func(ref string) string {
+		for _, r := range decl.References() {
+			if r.String() == ref {
+				r := r
+				description, ok := (&Reference{ref: &r, decl: decl}).Describe()
+				require.True(t, ok)
+				return description.Value
+			}
+		}
+		require.Failf(t, "missing reference", "no reference to %s", ref)
+		return ""
+	}
+	assert.Equal(t, "# Variable: settings\n**Type:** `Secret<{port: number}>`\n", describe("settings"))
+	assert.Equal(t, "# Property: settings.port\n**Type:** `number`\n\nThis value is secret.\n\n\n",
+		describe("settings.port"))
+	assert.Contains(t, describe("db.connectionString"), "This value is secret.")
+
+	variable := decl.Variables()["settings"].Source().ResolveType(decl)
+	assert.Equal(t, "secret<object {port: number}>", completionItemFromType(variable).Detail)
+}
+
+func TestDescribeObjectVariable(t *testing.T) {
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(`variables:
+  settings:
+    name: web
+    replicas: 3
+    ports:
+      - number: 80
+        public: true
+    tags:
+      env: prod
+outputs:
+  name: ${settings.name}
+  port: ${settings.ports[0].number}
+  env: ${settings.tags.env}
+  settings: ${settings}
+`))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	assert.Empty(t, decl.Diags())
+
+	describe := func(ref string) string {
+		for _, r := range decl.References() {
+			if r.String() == ref {
+				r := r
+				description, ok := (&Reference{ref: &r, decl: decl}).Describe()
+				require.True(t, ok)
+				return description.Value
+			}
+		}
+		require.Failf(t, "missing reference", "no reference to %s", ref)
+		return ""
+	}
+	assert.Equal(t, "# Property: settings.name\n**Type:** `string`\n\n\n", describe("settings.name"))
+	assert.Equal(t, "# Property: settings.ports[0].number\n**Type:** `number`\n\n\n",
+		describe("settings.ports[0].number"))
+	assert.Equal(t, "# Property: settings.tags.env\n**Type:** `string`\n\n\n", describe("settings.tags.env"))
+	assert.Equal(t, "# Variable: settings\n**Type:** `{name: string, replicas: number, "+
+		"ports: List<{number: number, public: boolean}>, tags: {env: string}}`\n", describe("settings"))
+
+	// Properties of the object are completed like those of a resource.
+	typ := decl.Variables()["settings"].Source().ResolveType(decl)
+	list, err := (&server{}).typePropertyCompletion(typ, "")
+	require.NoError(t, err)
+	labels := []string{}
+	for _, item := range list.Items {
+		labels = append(labels, item.Label+": "+item.Detail)
+	}
+	assert.Equal(t, []string{
+		"name: string", "replicas: number",
+		"ports: list<object {number: number, public: boolean}>", "tags: object {env: string}",
+	}, labels)
+}
+
+func TestKeysInAllStyles(t *testing.T) {
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  "res":
+    type: test:index:Resource
+    properties:
+      name: |
+        not: a key
+      rules: [{port: 80, }]
+  other: {type: 'test:index:Resource', properties: {}}
+`,
+	})}
+	names := func(keys []KeyPos) []string {
+		s := []string{}
+		for _, k := range keys {
+			s = append(s, k.B)
+		}
+		return s
+	}
+
+	top, err := topLevelKeys(doc)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]protocol.Position{"resources": {}}, top)
+
+	// Lines in multi-line strings are not keys.
+	children, err := childKeys(doc, protocol.Position{Line: 3, Character: 4})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]protocol.Position{
+		"name":  {Line: 4, Character: 6},
+		"rules": {Line: 6, Character: 6},
+	}, children)
+	parents, _, ok, err := parentKeys(doc, protocol.Position{Line: 5, Character: 12})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resources", "res", "properties", "name"}, names(parents))
+
+	// Quoted keys are unquoted, and flow lists are transparent.
+	parents, _, ok, err = parentKeys(doc, protocol.Position{Line: 6, Character: 25})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resources", "res", "properties", "rules"}, names(parents))
+
+	// Flow maps nest keys on a single line.
+	parents, _, ok, err = parentKeys(doc, protocol.Position{Line: 7, Character: 52})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resources", "other", "properties"}, names(parents))
+	siblings, ok, err := siblingKeys(doc, parents[2].A)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, map[string]protocol.Position{
+		"type":       {Line: 7, Character: 10},
+		"properties": {Line: 7, Character: 39},
+	}, siblings)
+	assert.Equal(t, "test:index:Resource", getTokenAtKey(doc, siblings["type"]))
+
+	// Positions on a key's line belong to the enclosing map.
+	parents, _, ok, err = parentKeys(doc, protocol.Position{Line: 2, Character: 12})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"resources", "res"}, names(parents))
+}
+
+func TestKeysInInvalidYAML(t *testing.T) {
+	// Lines being edited are left out, and the rest of the document is read as
+	// usual.
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{
+		URI: "file:///Pulumi.yaml",
+		Text: `resources:
+  res: {type: test:index:Resource}
+  other:
+    prop
+    properties: {name: foo}
+`,
+	})}
+	parents, _, ok, err := parentKeys(doc, protocol.Position{Line: 3, Character: 8})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, parents, 2)
+	assert.Equal(t, "other", parents[1].B)
+	children, err := childKeys(doc, parents[1].A)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]protocol.Position{"properties": {Line: 4, Character: 4}}, children)
+	assert.Equal(t, "test:index:Resource", getTokenAtKey(doc, protocol.Position{Line: 1, Character: 8}))
+
+	// Documents that can't be recovered are scanned line by line.
+	doc = &document{text: lsp.NewDocument(protocol.TextDocumentItem{
+		URI:  "file:///Pulumi.yaml",
+		Text: "resources:\n  res:\n    type: test:index:Resource\n    prop\n" + strings.Repeat("  - a\n  b\n", 10),
+	})}
+	parents, _, ok, err = parentKeys(doc, protocol.Position{Line: 3, Character: 8})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, parents, 2)
+	assert.Equal(t, "res", parents[1].B)
+}
+
+func TestEnclosingKeyOnFirstLine(t *testing.T) {
+	// Stack files usually start with the key that encloses everything else.
+	text := lsp.NewDocument(protocol.TextDocumentItem{
+		URI:  "file:///Pulumi.dev.yaml",
+		Text: "config:\n  aws:region: us-west-2\n",
+	})
+	key, ind, ok, err := enclosingKeyByIndentation(text, protocol.Position{Line: 1, Character: 2})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, protocol.Position{Line: 0, Character: 0}, key)
+	assert.Equal(t, 2, ind)
+}
+
+func TestDocumentIndentation(t *testing.T) {
+	detect := func(text string) (int, bool) {
+		return documentIndentation(lsp.NewDocument(protocol.TextDocumentItem{Text: text}))
+	}
+	n, ok := detect(`plugins:
+    providers:
+        - name: aws
+          path: ./bin
+resources:
+    res:
+        type: test:index:Resource
+        properties:
+            description: |
+              Lines in multi-line strings
+              are not counted.
+`)
+	require.True(t, ok)
+	assert.Equal(t, 4, n)
+
+	n, ok = detect("resources:\n  res:\n    type: test:index:Resource\n")
+	require.True(t, ok)
+	assert.Equal(t, 2, n)
+
+	_, ok = detect("name: project\nruntime: yaml\n")
+	assert.False(t, ok)
+}
+
+func TestKeyTreeInvalidation(t *testing.T) {
+	doc := &document{text: lsp.NewDocument(protocol.TextDocumentItem{
+		URI:  "file:///Pulumi.yaml",
+		Text: "resources: {}\n",
+	})}
+	tree := doc.keyTree()
+	require.NotNil(t, tree)
+	assert.Same(t, tree, doc.keyTree(), "the tree should be reused until the text changes")
+
+	err := doc.text.AcceptChanges([]protocol.TextDocumentContentChangeEvent{{Text: "variables: {}\n"}})
+	require.NoError(t, err)
+	doc.invalidateKeyTree()
+	top, err := topLevelKeys(doc)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]protocol.Position{"variables": {}}, top)
+}
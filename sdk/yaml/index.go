@@ -0,0 +1,231 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+// objectIndex finds the objects of a template at a position. It is built once
+// for each analysis of a document, and queried on every hover and completion.
+//
+// Spans are sorted by their start, and form an implicit balanced binary tree:
+// the root of spans[lo:hi] is the span in the middle, and maxEnd holds the
+// largest end in its subtree. A query visits O(log n + k) spans, where k is the
+// number of spans that contain the position.
+type objectIndex struct {
+	spans  []objectSpan
+	maxEnd []protocol.Position
+}
+
+// objectSpan is a range of the template that describes an object.
+type objectSpan struct {
+	rng protocol.Range
+	// The order the span was added in, which breaks ties between spans with
+	// the same range.
+	order int
+	// Objects are built when they are found, since the schemas they describe
+	// may be loaded after the index is built.
+	resolve func() (Object, error)
+}
+
+func (s objectSpan) contains(pos protocol.Position) bool {
+	return !posBefore(pos, s.rng.Start) && !posBefore(s.rng.End, pos)
+}
+
+// innerThan checks if `s` is more specific than `o`: it starts later, or ends
+// earlier.
+func (s objectSpan) innerThan(o objectSpan) bool {
+	if s.rng.Start != o.rng.Start {
+		return posBefore(o.rng.Start, s.rng.Start)
+	}
+	if s.rng.End != o.rng.End {
+		return posBefore(s.rng.End, o.rng.End)
+	}
+	return s.order < o.order
+}
+
+func newObjectIndex(spans []objectSpan) *objectIndex {
+	for i := range spans {
+		spans[i].order = i
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return posBefore(spans[i].rng.Start, spans[j].rng.Start)
+	})
+	idx := &objectIndex{spans: spans, maxEnd: make([]protocol.Position, len(spans))}
+	idx.fillMaxEnd(0, len(spans))
+	return idx
+}
+
+func (idx *objectIndex) fillMaxEnd(lo, hi int) protocol.Position {
+	if lo >= hi {
+		return protocol.Position{}
+	}
+	mid := (lo + hi) / 2
+	end := idx.spans[mid].rng.End
+	for _, child := range []protocol.Position{idx.fillMaxEnd(lo, mid), idx.fillMaxEnd(mid+1, hi)} {
+		if posBefore(end, child) {
+			end = child
+		}
+	}
+	idx.maxEnd[mid] = end
+	return end
+}
+
+// at returns the most specific object at `pos`, or nil if there is none.
+func (idx *objectIndex) at(pos protocol.Position) (Object, error) {
+	if idx == nil {
+		return nil, nil
+	}
+	var best *objectSpan
+	idx.visit(0, len(idx.spans), pos, func(s *objectSpan) {
+		if best == nil || s.innerThan(*best) {
+			best = s
+		}
+	})
+	if best == nil {
+		return nil, nil
+	}
+	return best.resolve()
+}
+
+// visit calls `f` on each span in spans[lo:hi] that contains `pos`.
+func (idx *objectIndex) visit(lo, hi int, pos protocol.Position, f func(*objectSpan)) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	if posBefore(idx.maxEnd[mid], pos) {
+		// Every span in this subtree ends before `pos`.
+		return
+	}
+	idx.visit(lo, mid, pos, f)
+	if posBefore(pos, idx.spans[mid].rng.Start) {
+		// The spans after `mid` start after `pos`.
+		return
+	}
+	if idx.spans[mid].contains(pos) {
+		f(&idx.spans[mid])
+	}
+	idx.visit(mid+1, hi, pos, f)
+}
+
+// buildObjectIndex indexes the custom timeouts, resource types, invoke tokens
+// and references of a template.
+func buildObjectIndex(template *ast.TemplateDecl, decl *bind.Decl) *objectIndex {
+	var spans []objectSpan
+	add := func(rng *hcl.Range, resolve func() (Object, error)) {
+		if rng != nil {
+			spans = append(spans, objectSpan{rng: convertRange(rng), resolve: resolve})
+		}
+	}
+	for _, r := range template.Resources.Entries {
+		r := r
+		if r.Value == nil {
+			continue
+		}
+		spans = append(spans, customTimeoutSpans(r.Value.Options.CustomTimeouts)...)
+		if r.Value.Type == nil {
+			continue
+		}
+		typeRange, ok := syntaxRange(r.Value.Type)
+		if !ok {
+			continue
+		}
+		add(typeRange, func() (Object, error) {
+			version := ""
+			if v := r.Value.Options.Version; v != nil {
+				version = v.Value
+			}
+			res, err := decl.GetResources(r.Value.Type.Value, version)
+			if err != nil {
+				return nil, err
+			}
+			if len(res) == 0 {
+				return nil, nil
+			}
+			keyRange, ok := syntaxRange(r.Key)
+			if !ok || r.Value.Syntax() == nil || r.Value.Syntax().Syntax() == nil {
+				return nil, nil
+			}
+			valueRange := r.Value.Syntax().Syntax().Range()
+			return Resource{
+				object: object{combineRange(convertRange(keyRange), convertRange(valueRange))},
+				schema: res[0].Schema(),
+			}, nil
+		})
+	}
+	for _, f := range decl.Invokes() {
+		expr := f.Expr()
+		if expr.Token == nil {
+			continue
+		}
+		tokenRange, ok := syntaxRange(expr.Token)
+		if !ok {
+			continue
+		}
+		add(tokenRange, func() (Object, error) {
+			rng, ok := syntaxRange(expr)
+			if !ok {
+				return nil, nil
+			}
+			invoke, _ := decl.LookupInvoke(expr)
+			return Invoke{
+				object: object{convertRange(rng)},
+				schema: invoke.Schema(),
+			}, nil
+		})
+	}
+	for _, r := range decl.References() {
+		r := r
+		add(r.Range(), func() (Object, error) {
+			return &Reference{
+				object: object{convertRange(r.Range())},
+				ref:    &r,
+				decl:   decl,
+			}, nil
+		})
+	}
+	return newObjectIndex(spans)
+}
+
+// customTimeoutSpans returns spans for the key and the value of each custom
+// timeout.
+func customTimeoutSpans(timeouts *ast.CustomTimeoutsDecl) []objectSpan {
+	if timeouts == nil {
+		return nil
+	}
+	obj, ok := timeouts.Syntax().(*syntax.ObjectNode)
+	if !ok {
+		return nil
+	}
+	var spans []objectSpan
+	for i := 0; i < obj.Len(); i++ {
+		kvp := obj.Index(i)
+		op := strings.ToLower(kvp.Key.Value())
+		if _, ok := customTimeoutDocs[op]; !ok || kvp.Key.Syntax() == nil || kvp.Value.Syntax() == nil {
+			continue
+		}
+		keyRange, valueRange := kvp.Key.Syntax().Range(), kvp.Value.Syntax().Range()
+		if keyRange == nil || valueRange == nil {
+			continue
+		}
+		timeout := CustomTimeout{
+			object:    object{combineRange(convertRange(keyRange), convertRange(valueRange))},
+			operation: op,
+		}
+		resolve := func() (Object, error) { return timeout, nil }
+		spans = append(spans,
+			objectSpan{rng: convertRange(keyRange), resolve: resolve},
+			objectSpan{rng: convertRange(valueRange), resolve: resolve})
+	}
+	return spans
+}
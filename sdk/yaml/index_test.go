@@ -0,0 +1,137 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
+)
+
+func TestObjectIndex(t *testing.T) {
+	span := func(name string, startLine, startChar, endLine, endChar uint32) objectSpan {
+		return objectSpan{
+			rng: protocol.Range{
+				Start: protocol.Position{Line: startLine, Character: startChar},
+				End:   protocol.Position{Line: endLine, Character: endChar},
+			},
+			resolve: func() (Object, error) { return CustomTimeout{operation: name}, nil },
+		}
+	}
+	idx := newObjectIndex([]objectSpan{
+		span("outer", 1, 0, 5, 10),
+		span("inner", 2, 4, 2, 12),
+		span("innermost", 2, 6, 2, 8),
+		span("later", 7, 0, 7, 4),
+	})
+	at := func(line, char uint32) string {
+		o, err := idx.at(protocol.Position{Line: line, Character: char})
+		require.NoError(t, err)
+		if o == nil {
+			return ""
+		}
+		return o.(CustomTimeout).operation
+	}
+
+	assert.Equal(t, "outer", at(1, 0))
+	assert.Equal(t, "inner", at(2, 4))
+	assert.Equal(t, "innermost", at(2, 7))
+	// Ranges include their end.
+	assert.Equal(t, "innermost", at(2, 8))
+	assert.Equal(t, "inner", at(2, 12))
+	assert.Equal(t, "outer", at(4, 20))
+	assert.Equal(t, "", at(6, 0))
+	assert.Equal(t, "later", at(7, 2))
+	assert.Equal(t, "", at(9, 0))
+}
+
+func TestBuildObjectIndex(t *testing.T) {
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(`resources:
+  res:
+    type: test:index:Resource
+    properties:
+      name: ${thing.id}
+    options:
+      customTimeouts:
+        create: 10m
+variables:
+  thing:
+    fn::invoke:
+      function: test:index:getThing
+`))
+	require.NoError(t, err)
+	require.False(t, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(t, err)
+	idx := buildObjectIndex(template, decl)
+	// The schema is loaded after the index is built.
+	decl.LoadSchema(context.Background(), testutil.Loader(testutil.Package()))
+
+	at := func(line, char uint32) Object {
+		o, err := idx.at(protocol.Position{Line: line, Character: char})
+		require.NoError(t, err)
+		return o
+	}
+	res, ok := at(2, 12).(Resource)
+	require.True(t, ok)
+	assert.Equal(t, "test:index:Resource", res.schema.Token)
+	ref, ok := at(4, 16).(*Reference)
+	require.True(t, ok)
+	assert.Equal(t, "thing.id", ref.ref.String())
+	timeout, ok := at(7, 17).(CustomTimeout)
+	require.True(t, ok)
+	assert.Equal(t, "create", timeout.operation)
+	invoke, ok := at(11, 20).(Invoke)
+	require.True(t, ok)
+	require.NotNil(t, invoke.schema)
+	assert.Equal(t, "test:index:getThing", invoke.schema.Token)
+	assert.Nil(t, at(3, 6))
+}
+
+// A template with `n` resources, each referencing the one before it.
+func largeTemplate(n int) string {
+	var b strings.Builder
+	b.WriteString("resources:\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "  res%d:\n    type: test:index:Resource\n    properties:\n", i)
+		fmt.Fprintf(&b, "      name: ${res%d.arn}-${res%d.arn}\n", max(i-1, 0), max(i-2, 0))
+		b.WriteString("    options:\n      customTimeouts:\n        create: 10m\n")
+	}
+	return b.String()
+}
+
+func BenchmarkObjectIndex(b *testing.B) {
+	// About 3,000 lines.
+	const resources = 430
+	template, diags, err := yaml.LoadYAML("Pulumi.yaml", strings.NewReader(largeTemplate(resources)))
+	require.NoError(b, err)
+	require.False(b, diags.HasErrors())
+	decl, err := bind.NewDecl(template)
+	require.NoError(b, err)
+
+	b.Run("build", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			buildObjectIndex(template, decl)
+		}
+	})
+	b.Run("query", func(b *testing.B) {
+		idx := buildObjectIndex(template, decl)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// The reference in the properties of a resource.
+			line := uint32(i%resources)*7 + 4
+			if _, err := idx.at(protocol.Position{Line: line, Character: 16}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
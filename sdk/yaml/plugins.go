@@ -0,0 +1,272 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/hashicorp/hcl/v2"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+// installedPluginVersions lists the versions of each resource plugin installed
+// on this machine, newest first.
+func installedPluginVersions() (map[string][]semver.Version, error) {
+	plugins, err := workspace.GetPlugins()
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string][]semver.Version{}
+	for _, p := range plugins {
+		if p.Kind != apitype.ResourcePlugin || p.Version == nil {
+			continue
+		}
+		versions[p.Name] = append(versions[p.Name], *p.Version)
+	}
+	for _, v := range versions {
+		sort.Slice(v, func(i, j int) bool { return v[i].GT(v[j]) })
+	}
+	return versions, nil
+}
+
+// How long a listing of the installed plugins is reused before the plugin
+// directory is scanned again.
+const installedPluginsTTL = time.Minute
+
+// pluginCache holds the installed plugin versions, so the plugin directory is
+// not scanned on every analysis.
+type pluginCache struct {
+	// Lists the installed versions of each resource plugin, newest first.
+	list func() (map[string][]semver.Version, error)
+
+	m        sync.Mutex
+	versions map[string][]semver.Version
+	// When `versions` was listed, or the zero time if it never was.
+	listed time.Time
+}
+
+func newPluginCache(list func() (map[string][]semver.Version, error)) *pluginCache {
+	return &pluginCache{list: list}
+}
+
+// get returns the installed plugin versions, listing them again if the last
+// listing is older than installedPluginsTTL.
+func (p *pluginCache) get() (map[string][]semver.Version, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.listed.IsZero() && time.Since(p.listed) < installedPluginsTTL {
+		return p.versions, nil
+	}
+	return p.refreshLocked()
+}
+
+// refresh lists the installed plugin versions, replacing the cached listing.
+func (p *pluginCache) refresh() (map[string][]semver.Version, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.refreshLocked()
+}
+
+func (p *pluginCache) refreshLocked() (map[string][]semver.Version, error) {
+	versions, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	p.versions, p.listed = versions, time.Now()
+	return versions, nil
+}
+
+// Complete the version pinned by a resource or invoke with the installed
+// versions of its package:
+//
+//	resources:
+//	  bucket:
+//	    type: aws:s3:Bucket
+//	    options:
+//	      version: 5.
+func (s *server) completeVersion(c lsp.Client, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	pos := params.Position
+	line, err := doc.text.Line(int(pos.Line))
+	if err != nil {
+		return nil, err
+	}
+	item := strings.TrimLeft(line[:min(int(pos.Character), len(line))], " ")
+	if !strings.HasPrefix(item, "version:") || s.plugins == nil {
+		return nil, nil
+	}
+	partial := strings.TrimLeft(strings.TrimLeft(strings.TrimPrefix(item, "version:"), " "), `"'`)
+
+	parents, _, ok, err := parentKeys(doc, pos)
+	if err != nil || !ok || len(parents) < 2 || strings.ToLower(parents[len(parents)-1].B) != "options" {
+		return nil, err
+	}
+	// The key that gives the token, which is a sibling of `options`.
+	var tokenKey string
+	switch {
+	case len(parents) == 3 && strings.ToLower(parents[0].B) == "resources":
+		tokenKey = "type"
+	case strings.ToLower(parents[len(parents)-2].B) == "fn::invoke":
+		tokenKey = "function"
+	default:
+		return nil, nil
+	}
+	keys, err := childKeys(doc, parents[len(parents)-2].A)
+	if err != nil {
+		return nil, err
+	}
+	tokenPos, ok := keys[tokenKey]
+	if !ok {
+		return nil, nil
+	}
+	pkg, ok := bind.PackageName(getTokenAtKey(doc, tokenPos))
+	if !ok {
+		return nil, nil
+	}
+
+	// Plugins may have been installed since the last listing, so list them
+	// again whenever the user asks for versions.
+	installed, err := s.plugins.refresh()
+	if err != nil {
+		c.LogInfof("Could not list installed plugins: %s", err.Error())
+		return nil, nil
+	}
+	replace := protocol.Range{
+		Start: protocol.Position{Line: pos.Line, Character: pos.Character - uint32(len(partial))},
+		End:   pos,
+	}
+	items := make([]protocol.CompletionItem, 0, len(installed[pkg]))
+	for i, v := range installed[pkg] {
+		version := v.String()
+		items = append(items, protocol.CompletionItem{
+			Label:      version,
+			Kind:       protocol.CompletionItemKindValue,
+			Detail:     fmt.Sprintf("Installed version of %s", pkg),
+			FilterText: version,
+			// Keep the newest versions first.
+			SortText: fmt.Sprintf("%04d", i),
+			TextEdit: &protocol.TextEdit{Range: replace, NewText: version},
+		})
+	}
+	return &protocol.CompletionList{Items: items}, nil
+}
+
+// versionActions offers to use each version pinned in a version conflict for
+// every use of the package.
+func (s *server) versionActions(doc *document, diag protocol.Diagnostic, conflict bind.VersionConflict) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	for _, version := range conflict.Versions() {
+		edits, ok := s.unifyVersionEdits(doc, conflict, version)
+		if !ok {
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title:       fmt.Sprintf("Use version %s of '%s' everywhere", version, conflict.Package),
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit:        &protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{doc.text.URI(): edits}},
+		})
+	}
+	return actions
+}
+
+// unifyVersionEdits pins every use in `conflict` to `version`. Uses of the
+// default version gain an `options.version` entry.
+func (s *server) unifyVersionEdits(doc *document, conflict bind.VersionConflict, version string) ([]protocol.TextEdit, bool) {
+	want, _ := semver.ParseTolerant(version)
+	var edits []protocol.TextEdit
+	for _, use := range conflict.Uses {
+		if use.Version == "" {
+			edit, ok := s.pinVersionEdit(doc, use.TokenRange, version)
+			if !ok {
+				return nil, false
+			}
+			edits = append(edits, edit)
+			continue
+		}
+		if v, err := semver.ParseTolerant(use.Version); use.Version == version || err == nil && v.EQ(want) {
+			continue
+		}
+		replace, quoted, ok := scalarRange(doc.text, use.VersionRange)
+		if !ok {
+			return nil, false
+		}
+		newText := yamlVersion(version)
+		if quoted {
+			newText = strconv.Quote(version)
+		}
+		edits = append(edits, protocol.TextEdit{Range: replace, NewText: newText})
+	}
+	return edits, true
+}
+
+// pinVersionEdit adds `options.version` to the resource or invoke whose token is
+// at `token`, such as
+//
+//	type: aws:s3:Bucket
+//	options:
+//	  version: 5.16.2
+func (s *server) pinVersionEdit(doc *document, token *hcl.Range, version string) (protocol.TextEdit, bool) {
+	if token == nil {
+		return protocol.TextEdit{}, false
+	}
+	tokenLine := convertPosition(token.Start).Line
+	line, err := doc.text.Line(int(tokenLine))
+	if err != nil {
+		return protocol.TextEdit{}, false
+	}
+	key := strings.TrimSpace(line)
+	if !strings.HasPrefix(key, "type:") && !strings.HasPrefix(key, "function:") {
+		// The token is not a key of a block map.
+		return protocol.TextEdit{}, false
+	}
+	indent, _ := indentationLevel(line)
+	siblings, _, err := siblingKeys(doc, protocol.Position{Line: tokenLine, Character: uint32(indent)})
+	if err != nil {
+		return protocol.TextEdit{}, false
+	}
+	entry := "version: " + yamlVersion(version) + "\n"
+	if opts, ok := siblings["options"]; ok {
+		if line, err := doc.text.Line(int(opts.Line)); err != nil || strings.TrimSpace(line) != "options:" {
+			// The options are not a block map.
+			return protocol.TextEdit{}, false
+		}
+		optIndent := strings.Repeat(" ", int(opts.Character)) + s.indentUnit(doc.text)
+		if children, err := childKeys(doc, opts); err == nil {
+			for _, child := range children {
+				optIndent = strings.Repeat(" ", int(child.Character))
+				break
+			}
+		}
+		at := protocol.Position{Line: opts.Line + 1}
+		return protocol.TextEdit{Range: protocol.Range{Start: at, End: at}, NewText: optIndent + entry}, true
+	}
+	prefix := strings.Repeat(" ", indent)
+	newText := prefix + "options:\n" + prefix + s.indentUnit(doc.text) + entry
+	at := protocol.Position{Line: tokenLine + 1}
+	if int(tokenLine)+1 >= doc.text.LineLen() {
+		// The token is on the last line, which has no newline.
+		at = protocol.Position{Line: tokenLine, Character: uint32(len(line))}
+		newText = "\n" + strings.TrimSuffix(newText, "\n")
+	}
+	return protocol.TextEdit{Range: protocol.Range{Start: at, End: at}, NewText: newText}, true
+}
+
+// Versions such as `5.0` would be read as numbers, so they are quoted.
+func yamlVersion(version string) string {
+	if _, err := strconv.ParseFloat(version, 64); err == nil {
+		return strconv.Quote(version)
+	}
+	return version
+}
@@ -0,0 +1,87 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"strings"
+
+	"github.com/blang/semver"
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/encoding"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/loader"
+)
+
+// prewarm loads the schemas of every package named in a newly opened document,
+// so the first hover or completion doesn't wait on loading them.
+//
+// Packages are found from resource types, invoke tokens, `options.version` and
+// `plugins.providers`. They are loaded concurrently, independent of the
+// analysis of the document, which waits on the same loads.
+func (s *server) prewarm(c lsp.Client, filename, text string) {
+	// The load should outlive the didOpen request. Logging should too, so the
+	// client is rebound to a context that is never canceled.
+	c, _ = lsp.ClientFromContext(context.WithoutCancel(c.Context()))
+	packages := referencedPackages(filename, text)
+	if len(packages) == 0 {
+		return
+	}
+	c.LogDebugf("Prefetching %d schemas for %s", len(packages), filename)
+	// The user hasn't asked for these packages yet, so the loads don't carry
+	// the client: they don't report progress or show failures. A package that
+	// fails to load is reported when the analysis of the document needs it.
+	loader.Prefetch(context.Background(), s.schemas, packages, func(d *schema.PackageDescriptor, err error) {
+		c.LogDebugf("Failed to prefetch schema %s: %s", d.Name, err)
+	})
+}
+
+// referencedPackages finds the packages named by a document, without loading
+// any of them.
+func referencedPackages(filename, text string) []schema.PackageDescriptor {
+	var packages []schema.PackageDescriptor
+	seen := map[string]bool{}
+	add := func(d schema.PackageDescriptor) {
+		key := d.Name
+		if d.Version != nil {
+			key += "@" + d.Version.String()
+		}
+		if !seen[key] {
+			seen[key] = true
+			packages = append(packages, d)
+		}
+	}
+
+	template, _, err := yaml.LoadYAML(filename, strings.NewReader(text))
+	if err == nil && template != nil {
+		// Binding errors are reported by the analysis pipeline. Whatever was
+		// bound is still worth loading.
+		if decl, _ := bind.NewDecl(template); decl != nil {
+			for _, d := range decl.Packages() {
+				add(d)
+			}
+		}
+	}
+
+	// `plugins` is not part of the template, so we read it directly.
+	var project struct {
+		Plugins *workspace.Plugins `yaml:"plugins"`
+	}
+	if err := encoding.YAML.Unmarshal([]byte(text), &project); err == nil && project.Plugins != nil {
+		for _, p := range project.Plugins.Providers {
+			if p.Name == "" {
+				continue
+			}
+			d := schema.PackageDescriptor{Name: p.Name}
+			if v, err := semver.ParseTolerant(p.Version); err == nil {
+				d.Version = &v
+			}
+			add(d)
+		}
+	}
+	return packages
+}
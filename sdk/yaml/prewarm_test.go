@@ -0,0 +1,42 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferencedPackages(t *testing.T) {
+	text := `name: test
+runtime: yaml
+plugins:
+  providers:
+    - name: local
+      path: ./bin
+      version: 0.1.0
+resources:
+  bucket:
+    type: aws:s3:Bucket
+  other:
+    type: aws:s3:Bucket
+    options:
+      version: 5.16.2
+  provider:
+    type: pulumi:providers:gcp
+variables:
+  ami:
+    fn::invoke:
+      function: random:index:getString
+`
+	packages := referencedPackages("Pulumi.yaml", text)
+	names := make([]string, len(packages))
+	for i, p := range packages {
+		names[i] = p.Name
+		if p.Version != nil {
+			names[i] += "@" + p.Version.String()
+		}
+	}
+	assert.ElementsMatch(t, []string{"aws", "aws@5.16.2", "gcp", "random", "local@0.1.0"}, names)
+}
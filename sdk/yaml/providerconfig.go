@@ -0,0 +1,284 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
+	"github.com/pulumi/pulumi/pkg/v3/codegen"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+// providerPackages finds the packages whose configuration may be set in the
+// stack: the packages used by the project and the namespaces of the keys set in
+// the stack. Packages used by the project keep the version they are used with.
+func (a *stackAnalysis) providerPackages(project *ast.TemplateDecl) []schema.PackageDescriptor {
+	var packages []schema.PackageDescriptor
+	seen := map[string]bool{}
+	if project != nil {
+		if decl, err := bind.NewDecl(project); err == nil {
+			for _, desc := range decl.Packages() {
+				if !seen[desc.Name] {
+					seen[desc.Name] = true
+					packages = append(packages, desc)
+				}
+			}
+		}
+	}
+	for _, k := range a.keys {
+		if a.isProjectKey(k) || k.namespace == "pulumi" || seen[k.namespace] {
+			continue
+		}
+		seen[k.namespace] = true
+		packages = append(packages, schema.PackageDescriptor{Name: k.namespace})
+	}
+	return packages
+}
+
+// loadProviders loads the configuration of the packages used by the stack, and
+// checks the provider keys set in the stack against it. It returns false if
+// `ctx` was canceled before the providers were loaded.
+//
+// Namespaces that don't name a loadable package are not checked, since they
+// may belong to something other than a provider.
+func (a *stackAnalysis) loadProviders(ctx context.Context, loader schema.ReferenceLoader) bool {
+	providers := map[string][]*schema.Property{}
+	for _, desc := range a.packages {
+		desc := desc
+		ref, err := loader.LoadPackageReferenceV2(ctx, &desc)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			continue
+		}
+		config, err := ref.Config()
+		if err != nil {
+			continue
+		}
+		providers[desc.Name] = config
+	}
+
+	var diags hcl.Diagnostics
+	for _, k := range a.keys {
+		if a.isProjectKey(k) {
+			continue
+		}
+		config, ok := providers[k.namespace]
+		if !ok {
+			continue
+		}
+		prop, ok := findProperty(config, k.name)
+		if !ok {
+			diags = append(diags, unknownProviderConfigDiag(k.key, k.namespace, k.rnge))
+			continue
+		}
+		if bad, typ, ok := mismatchedSchemaValue(prop.Type, k.value); ok {
+			loc := k.rnge
+			if s := bad.Syntax(); s != nil && s.Syntax() != nil {
+				loc = s.Syntax().Range()
+			}
+			diags = append(diags, stackConfigTypeDiag(k.key, displayConfigType(typ), loc))
+		}
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.providers = providers
+	a.diags = append(a.diags, diags...)
+	return true
+}
+
+func findProperty(props []*schema.Property, name string) (*schema.Property, bool) {
+	for _, p := range props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// mismatchedSchemaValue finds the part of a value set in a stack file that does
+// not conform to `typ`, returning it with the type it should have. As with
+// project configuration, scalars written as strings are accepted when they parse
+// as the expected type, and secure values are not checked.
+func mismatchedSchemaValue(typ schema.Type, value ast.Expr) (ast.Expr, schema.Type, bool) {
+	if value == nil || isSecureValue(value) {
+		return nil, nil, false
+	}
+	switch typ := codegen.UnwrapType(typ).(type) {
+	case *schema.EnumType:
+		s, ok := scalarString(value)
+		if !ok {
+			return value, typ, true
+		}
+		for _, e := range typ.Elements {
+			if fmt.Sprint(e.Value) == s {
+				return nil, nil, false
+			}
+		}
+		return value, typ, true
+	case *schema.ArrayType:
+		l, ok := value.(*ast.ListExpr)
+		if !ok {
+			return value, typ, isScalar(value)
+		}
+		for _, el := range l.Elements {
+			if bad, t, ok := mismatchedSchemaValue(typ.ElementType, el); ok {
+				return bad, t, true
+			}
+		}
+	case *schema.MapType:
+		o, ok := value.(*ast.ObjectExpr)
+		if !ok {
+			return value, typ, isScalar(value)
+		}
+		for _, entry := range o.Entries {
+			if bad, t, ok := mismatchedSchemaValue(typ.ElementType, entry.Value); ok {
+				return bad, t, true
+			}
+		}
+	case *schema.ObjectType:
+		o, ok := value.(*ast.ObjectExpr)
+		if !ok {
+			return value, typ, isScalar(value)
+		}
+		for _, entry := range o.Entries {
+			k, ok := entry.Key.(*ast.StringExpr)
+			if !ok {
+				continue
+			}
+			if prop, ok := typ.Property(k.Value); ok {
+				if bad, t, ok := mismatchedSchemaValue(prop.Type, entry.Value); ok {
+					return bad, t, true
+				}
+			}
+		}
+	case *schema.UnionType:
+		for _, t := range typ.ElementTypes {
+			if _, _, ok := mismatchedSchemaValue(t, value); !ok {
+				return nil, nil, false
+			}
+		}
+		return value, typ, true
+	default:
+		switch typ {
+		case schema.StringType:
+			_, ok := scalarString(value)
+			return value, typ, !ok
+		case schema.NumberType, schema.IntType, schema.BoolType:
+			s, ok := scalarString(value)
+			return value, typ, !ok || !parsesAs(typ, s)
+		}
+	}
+	return nil, nil, false
+}
+
+// parsesAs checks if the string `s` holds a value of the scalar type `typ`.
+func parsesAs(typ schema.Type, s string) bool {
+	var err error
+	switch typ {
+	case schema.NumberType:
+		_, err = strconv.ParseFloat(s, 64)
+	case schema.IntType:
+		_, err = strconv.ParseInt(s, 10, 64)
+	case schema.BoolType:
+		_, err = strconv.ParseBool(s)
+	}
+	return err == nil
+}
+
+// The text of a scalar value, or false if `e` is not a scalar.
+func scalarString(e ast.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *ast.StringExpr:
+		return e.Value, true
+	case *ast.NumberExpr:
+		return strconv.FormatFloat(e.Value, 'f', -1, 64), true
+	case *ast.BooleanExpr:
+		return strconv.FormatBool(e.Value), true
+	}
+	return "", false
+}
+
+func isScalar(e ast.Expr) bool {
+	_, ok := scalarString(e)
+	return ok
+}
+
+// isSecureValue checks if `e` is an encrypted value: `secure: <ciphertext>`.
+func isSecureValue(e ast.Expr) bool {
+	o, ok := e.(*ast.ObjectExpr)
+	if !ok || len(o.Entries) != 1 {
+		return false
+	}
+	k, ok := o.Entries[0].Key.(*ast.StringExpr)
+	return ok && k.Value == "secure"
+}
+
+// providerCompletions lists the provider configuration keys that are not yet set
+// in the stack.
+func (a *stackAnalysis) providerCompletions() []protocol.CompletionItem {
+	a.m.Lock()
+	defer a.m.Unlock()
+	set := map[string]bool{}
+	for _, k := range a.keys {
+		set[k.key] = true
+	}
+	items := []protocol.CompletionItem{}
+	for _, pkg := range sortedNames(a.providers) {
+		config := append([]*schema.Property{}, a.providers[pkg]...)
+		sort.Slice(config, func(i, j int) bool { return config[i].Name < config[j].Name })
+		for _, prop := range config {
+			key := pkg + ":" + prop.Name
+			if set[key] {
+				continue
+			}
+			items = append(items, protocol.CompletionItem{
+				Label:      key,
+				Kind:       protocol.CompletionItemKindProperty,
+				Detail:     displayConfigType(prop.Type),
+				InsertText: key + ": ",
+				Deprecated: prop.DeprecationMessage != "",
+				Documentation: protocol.MarkupContent{
+					Kind:  protocol.Markdown,
+					Value: prop.Comment,
+				},
+			})
+		}
+	}
+	return items
+}
+
+// The type of a configuration value, as displayed to the user. Enums are shown
+// as the set of values they accept.
+func displayConfigType(typ schema.Type) string {
+	if enum, ok := codegen.UnwrapType(typ).(*schema.EnumType); ok {
+		values := make([]string, len(enum.Elements))
+		for i, e := range enum.Elements {
+			values[i] = fmt.Sprintf("%q", fmt.Sprint(e.Value))
+		}
+		return strings.Join(values, " | ")
+	}
+	return diags.DisplayType(typ)
+}
+
+func unknownProviderConfigDiag(key, pkg string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Unknown configuration key '%s'", key),
+		Detail:   fmt.Sprintf("Package '%s' does not have a configuration variable named '%s'", pkg, strings.TrimPrefix(key, pkg+":")),
+		Subject:  loc,
+	}
+}
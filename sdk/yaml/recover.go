@@ -0,0 +1,118 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+)
+
+// The most lines removed while recovering a document. Documents with more
+// errors than this are probably not being edited one line at a time.
+const maxRecoveredLines = 8
+
+// recoverText removes the lines that stop `text` from parsing, so that a
+// document that is being edited can still be analyzed. Lines are blanked, so
+// the positions of everything else in the document are unchanged.
+//
+// `parse` reports if its argument parses, and otherwise the line (starting at 1)
+// of the error. Parsers often report errors after their cause, so both the line
+// of the error and the line before it are tried.
+func recoverText(text string, parse func(text string) (line int, ok bool)) (string, bool) {
+	lines := strings.Split(text, "\n")
+	line, ok := parse(text)
+	for removed := 0; !ok; removed++ {
+		if removed == maxRecoveredLines || line <= 0 {
+			return "", false
+		}
+		var best []string
+		bestLine := 0
+		for _, candidate := range recoveryCandidates(lines, line-1) {
+			attempt := append([]string{}, lines...)
+			attempt[candidate] = ""
+			l, ok := parse(strings.Join(attempt, "\n"))
+			if ok {
+				return strings.Join(attempt, "\n"), true
+			}
+			if l > bestLine {
+				best, bestLine = attempt, l
+			}
+		}
+		if best == nil {
+			return "", false
+		}
+		lines, line = best, bestLine
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// The lines that might cause an error reported on line `errLine`: the closest
+// non-blank line at or before `errLine`, and the non-blank line before that.
+//
+// Lines that don't look like a key or a list item, such as a key that is still
+// being typed, are the most likely cause, so they are tried first.
+func recoveryCandidates(lines []string, errLine int) []int {
+	var candidates []int
+	for l := min(errLine, len(lines)-1); l >= 0 && len(candidates) < 2; l-- {
+		if strings.TrimSpace(lines[l]) != "" {
+			candidates = append(candidates, l)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return !isEntryLine(lines[candidates[i]]) && isEntryLine(lines[candidates[j]])
+	})
+	return candidates
+}
+
+// isEntryLine checks if `line` looks like a map entry or a list item.
+func isEntryLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "-") || strings.HasPrefix(line, "#") ||
+		strings.HasSuffix(line, ":") || strings.Contains(line, ": ")
+}
+
+// recoverTemplate parses as much of `text` as it can, by removing the lines that
+// don't parse. It returns nil if the template can't be recovered.
+//
+// Diagnostics from the recovered template describe a different document than
+// the user wrote, so they are not returned.
+func recoverTemplate(filename, text string) *ast.TemplateDecl {
+	var template *ast.TemplateDecl
+	_, ok := recoverText(text, func(text string) (int, bool) {
+		t, diags, err := yaml.LoadYAML(filename, strings.NewReader(text))
+		if err != nil {
+			return 0, false
+		}
+		if t != nil {
+			template = t
+			return 0, true
+		}
+		return errorLine(diags), false
+	})
+	if !ok {
+		return nil
+	}
+	return template
+}
+
+// errorLine returns the line of the first error in `diags`, or 0 if the line is
+// not known.
+func errorLine(diags syntax.Diagnostics) int {
+	for _, d := range diags {
+		if d.Severity != hcl.DiagError {
+			continue
+		}
+		if d.Subject != nil {
+			return d.Subject.Start.Line
+		}
+		if line, ok := inferParseErrorLine(d.Summary); ok {
+			return line
+		}
+	}
+	return 0
+}
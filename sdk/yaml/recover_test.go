@@ -0,0 +1,40 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverTemplate(t *testing.T) {
+	// The line being edited is removed, whether the error is reported on it or
+	// on the line after it.
+	template := recoverTemplate("Pulumi.yaml", `resources:
+  res:
+    type: test:index:Resource
+    prop
+    properties:
+      name: foo
+  other:
+    type: eks:
+    properties: {}
+outputs:
+  name: ${res.name}
+`)
+	require.NotNil(t, template)
+	require.Len(t, template.Resources.Entries, 2)
+	res := template.Resources.Entries[0]
+	assert.Equal(t, "res", res.Key.Value)
+	assert.Equal(t, "test:index:Resource", res.Value.Type.Value)
+	require.Len(t, res.Value.Properties.Entries, 1)
+	// Positions are those of the text as written.
+	assert.Equal(t, 6, res.Value.Properties.Entries[0].Key.Syntax().Syntax().Range().Start.Line)
+	assert.Nil(t, template.Resources.Entries[1].Value.Type)
+	require.Len(t, template.Outputs.Entries, 1)
+
+	// Templates that are not maps can't be recovered.
+	assert.Nil(t, recoverTemplate("Pulumi.yaml", "- a\n- b\n"))
+}
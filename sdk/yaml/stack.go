@@ -0,0 +1,342 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/ast"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/diags"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax"
+	"github.com/pulumi/pulumi-yaml/pkg/pulumiyaml/syntax/encoding"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/bind"
+)
+
+// isStackFile checks if `filename` is a stack configuration file:
+// `Pulumi.<stack>.yaml`.
+func isStackFile(filename string) bool {
+	base := filepath.Base(filename)
+	for _, ext := range []string{".yaml", ".yml"} {
+		if strings.HasPrefix(base, "Pulumi.") && strings.HasSuffix(base, ext) {
+			return len(base) > len("Pulumi.")+len(ext)
+		}
+	}
+	return false
+}
+
+// The analysis of a stack configuration file, checked against the
+// configuration declared by its project.
+type stackAnalysis struct {
+	// The name of the project, if a project was found.
+	project string
+	// The project file that declares the configuration.
+	projectURI protocol.DocumentURI
+	// The configuration declared by the project, keyed by name.
+	declared map[string]*bind.ConfigMapEntry
+
+	// The keys set in the stack file's `config` block.
+	keys []stackConfigKey
+
+	// The packages whose configuration may be set in the stack.
+	packages []schema.PackageDescriptor
+	// Cancels loading the providers' configuration.
+	cancel context.CancelFunc
+
+	// Guards the fields set when the providers' configuration is loaded.
+	m sync.Mutex
+	// The configuration of each loaded provider, keyed by package name.
+	providers map[string][]*schema.Property
+	diags     hcl.Diagnostics
+}
+
+// A key set in a stack file.
+type stackConfigKey struct {
+	// The key as written, such as `project:name` or `aws:region`.
+	key string
+	// The namespace of the key. Keys without a namespace belong to the project.
+	namespace string
+	// The name of the key within its namespace.
+	name  string
+	rnge  *hcl.Range
+	value ast.Expr
+}
+
+// analyzeStack checks a stack configuration file against its project, which is
+// found in the same directory.
+func (s *server) analyzeStack(text lsp.Document) *stackAnalysis {
+	filename := text.URI().Filename()
+	a := &stackAnalysis{declared: map[string]*bind.ConfigMapEntry{}}
+
+	var configKey *hcl.Range
+	obj, sdiags := encoding.DecodeYAML(filename, yamlv3.NewDecoder(strings.NewReader(text.String())), yaml.TagDecoder)
+	a.diags = append(a.diags, sdiags.HCL()...)
+	if obj != nil {
+		for i := 0; i < obj.Len(); i++ {
+			kvp := obj.Index(i)
+			if kvp.Key.Value() != "config" {
+				continue
+			}
+			configKey = kvp.Key.Syntax().Range()
+			if config, ok := kvp.Value.(*syntax.ObjectNode); ok {
+				a.keys = parseStackKeys(config)
+			}
+		}
+	}
+
+	project, ok := s.loadProject(filepath.Dir(filename))
+	a.packages = a.providerPackages(project)
+	if !ok {
+		return a
+	}
+	a.projectURI = uri.File(project.Syntax().Syntax().Range().Filename)
+	if project.Name != nil {
+		a.project = project.Name.Value
+	}
+	a.declared = bind.ProjectConfig(project)
+	a.validate(configKey)
+	return a
+}
+
+func parseStackKeys(config *syntax.ObjectNode) []stackConfigKey {
+	keys := make([]stackConfigKey, 0, config.Len())
+	for i := 0; i < config.Len(); i++ {
+		kvp := config.Index(i)
+		key := stackConfigKey{
+			key:  kvp.Key.Value(),
+			name: kvp.Key.Value(),
+			rnge: kvp.Key.Syntax().Range(),
+		}
+		if ns, name, ok := strings.Cut(key.key, ":"); ok {
+			key.namespace, key.name = ns, name
+		}
+		key.value, _ = ast.ParseExpr(kvp.Value)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadProject parses the project file in `dir`. If the project file is open, its
+// current text is used.
+func (s *server) loadProject(dir string) (*ast.TemplateDecl, bool) {
+	for _, name := range []string{"Pulumi.yaml", "Pulumi.yml"} {
+		path := filepath.Join(dir, name)
+		var text []byte
+		if doc, ok := s.getDocument(uri.File(path)); ok {
+			text = []byte(doc.text.String())
+		} else if b, err := os.ReadFile(path); err == nil {
+			text = b
+		} else {
+			continue
+		}
+		template, _, err := yaml.LoadYAMLBytes(path, text)
+		if err != nil || template == nil || template.Syntax() == nil {
+			return nil, false
+		}
+		return template, true
+	}
+	return nil, false
+}
+
+// isProjectKey checks if a key belongs to the project, and not to a provider.
+func (a *stackAnalysis) isProjectKey(k stackConfigKey) bool {
+	return k.namespace == "" || k.namespace == a.project
+}
+
+// validate checks the keys set in the stack against the configuration declared
+// by the project. `configKey` is the location of the `config` key, if any.
+func (a *stackAnalysis) validate(configKey *hcl.Range) {
+	set := map[string]bool{}
+	for _, k := range a.keys {
+		if !a.isProjectKey(k) {
+			continue
+		}
+		set[k.name] = true
+		entry, ok := a.declared[k.name]
+		if !ok {
+			a.diags = append(a.diags, unknownStackConfigDiag(k.key, a.project,
+				sortedNames(a.declared), k.rnge))
+			continue
+		}
+		if bad, ok := mismatchedStackValue(entry, k.value); ok {
+			loc := k.rnge
+			if s := bad.Syntax(); s != nil && s.Syntax() != nil {
+				loc = s.Syntax().Range()
+			}
+			a.diags = append(a.diags, stackConfigTypeDiag(k.key,
+				diags.DisplayType(entry.ResolveType(nil)), loc))
+		}
+	}
+	if configKey == nil {
+		configKey = &hcl.Range{Start: hcl.Pos{Line: 1, Column: 1}, End: hcl.Pos{Line: 1, Column: 1}}
+	}
+	for _, name := range sortedNames(a.declared) {
+		if a.declared[name].Required() && !set[name] {
+			a.diags = append(a.diags, missingStackConfigDiag(a.project+":"+name, configKey))
+		}
+	}
+}
+
+// mismatchedStackValue checks a value set in a stack file. Stack files usually
+// store scalar values as strings, so strings are accepted when they parse as the
+// declared type. Secure values are encrypted, so they can't be checked.
+func mismatchedStackValue(entry *bind.ConfigMapEntry, value ast.Expr) (ast.Expr, bool) {
+	switch v := value.(type) {
+	case *ast.ObjectExpr:
+		if isSecureValue(v) {
+			return nil, false
+		}
+	case *ast.NumberExpr, *ast.BooleanExpr:
+		if entry.ResolveType(nil) == schema.StringType {
+			// Scalars are read as strings.
+			return nil, false
+		}
+	case *ast.StringExpr:
+		return v, !parsesAs(entry.ResolveType(nil), v.Value)
+	}
+	return entry.MismatchedValue(value)
+}
+
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Publish the diagnostics of a stack file.
+func (a *stackAnalysis) sendDiags(c lsp.Client, uri protocol.DocumentURI) error {
+	a.m.Lock()
+	diags := append(hcl.Diagnostics{}, a.diags...)
+	a.m.Unlock()
+	return publishDiags(c, uri, diags)
+}
+
+// Stop loading the providers' configuration.
+func (a *stackAnalysis) stop() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// The key set at `pos`, if any.
+func (a *stackAnalysis) keyAt(pos protocol.Position) (stackConfigKey, bool) {
+	for _, k := range a.keys {
+		if posInRange(k.rnge, pos) {
+			return k, true
+		}
+	}
+	return stackConfigKey{}, false
+}
+
+// Complete project and provider configuration keys in the `config` block of a
+// stack file.
+func (s *server) completeStack(c lsp.Client, doc *document, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	a := doc.stack
+	if a == nil {
+		return nil, nil
+	}
+	parents, _, ok, err := parentKeys(doc, params.Position)
+	if err != nil || !ok || len(parents) != 1 || parents[0].B != "config" {
+		return nil, err
+	}
+	line, err := doc.text.Line(int(params.Position.Line))
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(line[:min(int(params.Position.Character), len(line))], ": ") {
+		// We are completing a value, not a key.
+		return nil, nil
+	}
+	set := map[string]bool{}
+	for _, k := range a.keys {
+		if a.isProjectKey(k) {
+			set[k.name] = true
+		}
+	}
+	items := []protocol.CompletionItem{}
+	for _, name := range sortedNames(a.declared) {
+		if set[name] {
+			continue
+		}
+		entry := a.declared[name]
+		key := a.project + ":" + name
+		item := protocol.CompletionItem{
+			Label:      key,
+			Kind:       protocol.CompletionItemKindProperty,
+			InsertText: key + ": ",
+		}
+		if typ := entry.ResolveType(nil); typ != nil {
+			item.Detail = diags.DisplayType(typ)
+		}
+		if entry.IsSecret() {
+			item.Documentation = "This value is secret. Set it with `pulumi config set --secret`."
+		}
+		items = append(items, item)
+	}
+	items = append(items, a.providerCompletions()...)
+	return &protocol.CompletionList{Items: items}, nil
+}
+
+// Find the declaration of the project configuration key at `pos`.
+func (a *stackAnalysis) definition(pos protocol.Position) []protocol.Location {
+	k, ok := a.keyAt(pos)
+	if !ok || !a.isProjectKey(k) {
+		return nil
+	}
+	entry, ok := a.declared[k.name]
+	if !ok {
+		return nil
+	}
+	r := entry.DefinitionRange()
+	if r == nil {
+		return nil
+	}
+	return []protocol.Location{{URI: a.projectURI, Range: convertRange(r)}}
+}
+
+func unknownStackConfigDiag(key, project string, declared []string, loc *hcl.Range) *hcl.Diagnostic {
+	detail := fmt.Sprintf("Project '%s' does not declare '%s'", project, key)
+	if len(declared) > 0 {
+		detail += fmt.Sprintf(". Declared configuration is: %s", strings.Join(declared, ", "))
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  fmt.Sprintf("Unknown configuration key '%s'", key),
+		Detail:   detail,
+		Subject:  loc,
+	}
+}
+
+func stackConfigTypeDiag(key, typ string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Value for '%s' must be of type %s", key, typ),
+		Subject:  loc,
+	}
+}
+
+func missingStackConfigDiag(key string, loc *hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("Missing required configuration '%s'", key),
+		Detail:   "The project declares this configuration without a default, so the stack must set it.",
+		Subject:  loc,
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/testutil"
+)
+
+func TestIsStackFile(t *testing.T) {
+	assert.True(t, isStackFile("/proj/Pulumi.dev.yaml"))
+	assert.True(t, isStackFile("Pulumi.prod.yml"))
+	assert.False(t, isStackFile("/proj/Pulumi.yaml"))
+	assert.False(t, isStackFile("/proj/Main.yaml"))
+}
+
+func TestAnalyzeStack(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Pulumi.yaml"), []byte(`name: proj
+runtime: yaml
+config:
+  region:
+    type: string
+  count:
+    type: integer
+    default: 1
+  names:
+    type: List<String>
+`), 0o600))
+
+	s := &server{docs: map[protocol.DocumentURI]*document{}}
+	stack := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: uri.File(filepath.Join(dir, "Pulumi.dev.yaml")),
+		Text: `config:
+  proj:count: "many"
+  proj:unknown: 1
+  aws:region: us-west-2
+  proj:names: [a, b]
+`,
+	})
+	a := s.analyzeStack(stack)
+	summaries := []string{}
+	for _, d := range a.diags {
+		summaries = append(summaries, d.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		"Value for 'proj:count' must be of type integer",
+		"Unknown configuration key 'proj:unknown'",
+		"Missing required configuration 'proj:region'",
+	}, summaries)
+
+	// Go to definition jumps to the declaration in the project.
+	locs := a.definition(protocol.Position{Line: 1, Character: 4})
+	require.Len(t, locs, 1)
+	assert.Equal(t, uri.File(filepath.Join(dir, "Pulumi.yaml")), locs[0].URI)
+	assert.Equal(t, uint32(5), locs[0].Range.Start.Line)
+
+	doc := &document{text: stack, server: s, stack: a}
+	list, err := s.completeStack(lsp.Client{}, doc, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			Position: protocol.Position{Line: 3, Character: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, list)
+	labels := []string{}
+	for _, item := range list.Items {
+		labels = append(labels, item.Label)
+	}
+	assert.Equal(t, []string{"proj:region"}, labels)
+}
+
+func TestStackProviderConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Pulumi.yaml"), []byte(`name: proj
+runtime: yaml
+`), 0o600))
+
+	loader := testutil.Loader(schema.PackageSpec{
+		Name: "aws",
+		Config: schema.ConfigSpec{Variables: map[string]schema.PropertySpec{
+			"region": {
+				Description: "The region to deploy to.",
+				TypeSpec:    schema.TypeSpec{Ref: "#/types/aws:index:Region"},
+			},
+			"maxRetries":   {TypeSpec: schema.TypeSpec{Type: "integer"}},
+			"skipMetadata": {TypeSpec: schema.TypeSpec{Type: "boolean"}},
+		}},
+		Types: map[string]schema.ComplexTypeSpec{
+			"aws:index:Region": {
+				ObjectTypeSpec: schema.ObjectTypeSpec{Type: "string"},
+				Enum: []schema.EnumValueSpec{
+					{Value: "us-east-1"}, {Value: "us-west-2"},
+				},
+			},
+		},
+	})
+
+	s := &server{docs: map[protocol.DocumentURI]*document{}}
+	stack := lsp.NewDocument(protocol.TextDocumentItem{
+		URI: uri.File(filepath.Join(dir, "Pulumi.dev.yaml")),
+		Text: `config:
+  aws:region: us-north-9
+  aws:maxRetries: "3"
+  aws:regoin: us-west-2
+  other:key: value
+`,
+	})
+	a := s.analyzeStack(stack)
+	require.True(t, a.loadProviders(context.Background(), loader))
+	summaries := []string{}
+	for _, d := range a.diags {
+		summaries = append(summaries, d.Summary)
+	}
+	assert.ElementsMatch(t, []string{
+		`Value for 'aws:region' must be of type "us-east-1" | "us-west-2"`,
+		"Unknown configuration key 'aws:regoin'",
+	}, summaries)
+
+	doc := &document{text: stack, server: s, stack: a}
+	list, err := s.completeStack(lsp.Client{}, doc, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			Position: protocol.Position{Line: 4, Character: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, list)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "aws:skipMetadata", list.Items[0].Label)
+	assert.Equal(t, "boolean", list.Items[0].Detail)
+}
@@ -0,0 +1,323 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package yaml
+
+import (
+	"strings"
+
+	"go.lsp.dev/protocol"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
+)
+
+// yamlTree is a position indexed view of the keys in a YAML document. Unlike a
+// line by line scan, it understands every YAML style: flow maps and lists,
+// quoted keys and multi-line strings.
+//
+// YAML nodes only record where they start, so each entry spans from its key to
+// the next key in its map, and flow collections are measured by matching their
+// brackets.
+type yamlTree struct {
+	lines []string
+	root  *treeMap
+}
+
+// treeMap is a YAML map, with the positions of its entries.
+type treeMap struct {
+	entries []*treeEntry
+	flow    bool
+	// For flow maps, start is the opening brace and end the closing brace.
+	start, end protocol.Position
+}
+
+// treeEntry is a key in a YAML map and the value it holds.
+type treeEntry struct {
+	name string
+	// The start of the key.
+	key protocol.Position
+	// The end of the entry, which is where the next entry starts.
+	end   protocol.Position
+	value *yamlv3.Node
+	// The entry is part of a block map.
+	block bool
+	// The maps held by the value: the value itself, or the items of a list.
+	maps []*treeMap
+}
+
+// parseTree builds the key tree of `text`. Lines that don't parse are left out.
+// It returns nil if `text` can't be recovered into a YAML map.
+func parseTree(text lsp.Document) *yamlTree {
+	s := text.String()
+	var doc yamlv3.Node
+	_, ok := recoverText(s, func(text string) (int, bool) {
+		doc = yamlv3.Node{}
+		if err := yamlv3.Unmarshal([]byte(text), &doc); err != nil {
+			line, _ := inferParseErrorLine(err.Error())
+			return line, false
+		}
+		return 0, true
+	})
+	if !ok || doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 ||
+		doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil
+	}
+	// Recovery blanks lines without moving anything, so positions are read
+	// from the text as written.
+	t := &yamlTree{lines: strings.Split(s, "\n")}
+	// The document ends after its last line.
+	t.root = t.mapping(doc.Content[0], protocol.Position{Line: uint32(len(t.lines))})
+	return t
+}
+
+// keyTree returns the key tree of the document's text. Completion looks up keys
+// many times for each request, so the tree is built once per change.
+func (d *document) keyTree() *yamlTree {
+	d.tree.Lock()
+	defer d.tree.Unlock()
+	if !d.tree.built {
+		d.tree.tree, d.tree.built = parseTree(d.text), true
+	}
+	return d.tree.tree
+}
+
+// invalidateKeyTree discards the key tree after the text changes.
+func (d *document) invalidateKeyTree() {
+	d.tree.Lock()
+	defer d.tree.Unlock()
+	d.tree.tree, d.tree.built = nil, false
+}
+
+func nodePos(n *yamlv3.Node) protocol.Position {
+	return protocol.Position{Line: uint32(n.Line - 1), Character: uint32(n.Column - 1)}
+}
+
+func isFlow(n *yamlv3.Node) bool {
+	return n.Style&yamlv3.FlowStyle != 0
+}
+
+func (t *yamlTree) mapping(n *yamlv3.Node, end protocol.Position) *treeMap {
+	m := &treeMap{flow: isFlow(n), start: nodePos(n), end: end}
+	if m.flow {
+		m.end = t.flowEnd(m.start)
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		m.entries = append(m.entries, &treeEntry{
+			name:  k.Value,
+			key:   nodePos(k),
+			value: v,
+			block: !m.flow,
+		})
+	}
+	for i, e := range m.entries {
+		e.end = m.end
+		if i+1 < len(m.entries) {
+			e.end = m.entries[i+1].key
+		}
+		e.maps = t.collections(e.value, e.end)
+	}
+	return m
+}
+
+// collections returns the maps held by `n`, which ends at `end`. List items are
+// transparent, so the maps in a list are returned in order.
+func (t *yamlTree) collections(n *yamlv3.Node, end protocol.Position) []*treeMap {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		return []*treeMap{t.mapping(n, end)}
+	case yamlv3.SequenceNode:
+		if isFlow(n) {
+			end = t.flowEnd(nodePos(n))
+		}
+		var maps []*treeMap
+		for i, item := range n.Content {
+			itemEnd := end
+			if i+1 < len(n.Content) {
+				itemEnd = nodePos(n.Content[i+1])
+			}
+			maps = append(maps, t.collections(item, itemEnd)...)
+		}
+		return maps
+	default:
+		return nil
+	}
+}
+
+// flowEnd finds the bracket that closes the flow collection opened at `start`.
+// Brackets in quoted strings and comments are skipped. If the collection is
+// never closed, the end of the document is returned.
+func (t *yamlTree) flowEnd(start protocol.Position) protocol.Position {
+	depth := 0
+	for l := int(start.Line); l < len(t.lines); l++ {
+		line := t.lines[l]
+		c := 0
+		if l == int(start.Line) {
+			c = int(start.Character)
+		}
+	scan:
+		for ; c < len(line); c++ {
+			switch line[c] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return protocol.Position{Line: uint32(l), Character: uint32(c)}
+				}
+			case '"', '\'':
+				// Quoted strings in flow collections may span lines, but
+				// keys and tokens don't, so a missing quote ends the line.
+				end, ok := closingQuote(line, c)
+				if !ok {
+					break scan
+				}
+				c = end
+			case '#':
+				if c == 0 || line[c-1] == ' ' || line[c-1] == '\t' {
+					break scan
+				}
+			}
+		}
+	}
+	return protocol.Position{Line: uint32(len(t.lines))}
+}
+
+// lineIndentation returns the indentation of the line `pos` is on.
+func (t *yamlTree) lineIndentation(pos protocol.Position) int {
+	if int(pos.Line) >= len(t.lines) {
+		return 0
+	}
+	ind, _ := indentationLevel(t.lines[pos.Line])
+	return ind
+}
+
+// contains checks if `pos` is in the map.
+func (m *treeMap) contains(pos protocol.Position) bool {
+	if m.flow {
+		return posBefore(m.start, pos) && !posBefore(m.end, pos)
+	}
+	return !posBefore(pos, m.start) && posBefore(pos, m.end)
+}
+
+// posBefore checks if `a` comes before `b`.
+func posBefore(a, b protocol.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
+
+// encloses checks if `pos` is inside the value of the entry, where a key at
+// `pos` would be a child of the entry.
+func (t *yamlTree) encloses(e *treeEntry, pos protocol.Position) bool {
+	if !posBefore(pos, e.end) {
+		return false
+	}
+	if (e.value.Kind == yamlv3.MappingNode || e.value.Kind == yamlv3.SequenceNode) && isFlow(e.value) {
+		// Inside the brackets of the value.
+		return posBefore(nodePos(e.value), pos) && !posBefore(t.flowEnd(nodePos(e.value)), pos)
+	}
+	if !e.block || pos.Line <= e.key.Line {
+		// A position on the same line as the key is part of its value only
+		// if the value is a flow collection.
+		return false
+	}
+	// Block values are indented past their key.
+	return t.lineIndentation(pos) > int(e.key.Character)
+}
+
+// enclosing returns the chain of entries that enclose `pos`, from the top level
+// down.
+func (t *yamlTree) enclosing(pos protocol.Position) []*treeEntry {
+	var chain []*treeEntry
+	maps := []*treeMap{t.root}
+	for {
+		var next *treeEntry
+		for _, m := range maps {
+			if !m.contains(pos) {
+				continue
+			}
+			for _, e := range m.entries {
+				if t.encloses(e, pos) {
+					next = e
+				}
+			}
+		}
+		if next == nil {
+			return chain
+		}
+		chain = append(chain, next)
+		maps = next.maps
+	}
+}
+
+// entryAt returns the entry whose key is at `pos`. If no key starts at `pos`, the
+// first key on the same line after `pos` is returned.
+func (t *yamlTree) entryAt(pos protocol.Position) (*treeEntry, bool) {
+	var best *treeEntry
+	var visit func(m *treeMap) bool
+	visit = func(m *treeMap) bool {
+		for _, e := range m.entries {
+			if e.key == pos {
+				best = e
+				return true
+			}
+			if e.key.Line == pos.Line && e.key.Character > pos.Character &&
+				(best == nil || e.key.Character < best.key.Character) {
+				best = e
+			}
+			for _, child := range e.maps {
+				if visit(child) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	visit(t.root)
+	return best, best != nil
+}
+
+// children returns the keys of the map held by `e`.
+func (e *treeEntry) children() []*treeEntry {
+	if e.value.Kind != yamlv3.MappingNode || len(e.maps) != 1 {
+		return nil
+	}
+	return e.maps[0].entries
+}
+
+// scalarAtKey returns the value of the key at `pos`, if the value is a scalar.
+func scalarAtKey(doc *document, pos protocol.Position) (string, bool) {
+	tree := doc.keyTree()
+	if tree == nil {
+		return "", false
+	}
+	e, ok := tree.entryAt(pos)
+	if !ok || e.value.Kind != yamlv3.ScalarNode {
+		return "", false
+	}
+	return e.value.Value, true
+}
+
+// flowKeyAt checks if `pos` is in a flow map. If it is, `onKey` reports if the
+// cursor is on the key of an entry, rather than its value:
+//
+//	properties: { name: foo, na| }
+func flowKeyAt(doc *document, pos protocol.Position) (inMap, onKey bool) {
+	tree := doc.keyTree()
+	if tree == nil {
+		return false, false
+	}
+	chain := tree.enclosing(pos)
+	if len(chain) == 0 {
+		return false, false
+	}
+	value := chain[len(chain)-1].value
+	if value.Kind != yamlv3.MappingNode || !isFlow(value) || int(pos.Line) >= len(tree.lines) {
+		return false, false
+	}
+	line := tree.lines[pos.Line]
+	entry := line[:min(int(pos.Character), len(line))]
+	if i := strings.LastIndexAny(entry, "{,"); i >= 0 {
+		entry = entry[i+1:]
+	}
+	return true, !strings.Contains(entry, ":")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/blang/semver"
 	"github.com/hashicorp/hcl/v2"
 	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
 
 	yaml "github.com/pulumi/pulumi-yaml/pkg/pulumiyaml"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
@@ -25,6 +26,15 @@ func convertRange(r *hcl.Range) protocol.Range {
 	}
 }
 
+// The URI of the file a range is in. Ranges without a file name are assumed to
+// be in `def`.
+func rangeURI(r *hcl.Range, def protocol.DocumentURI) protocol.DocumentURI {
+	if r.Filename == "" || r.Filename == def.Filename() {
+		return def
+	}
+	return uri.File(r.Filename)
+}
+
 func convertPosition(p hcl.Pos) protocol.Position {
 	var defPos hcl.Pos
 	var defProto protocol.Position
@@ -103,7 +113,7 @@ func resolveResource(c lsp.Client, loader schema.ReferenceLoader, token, version
 		}
 		v = &version
 	}
-	schema, err := loader.LoadPackageReference(pkg, v)
+	schema, err := loader.LoadPackageReferenceV2(c.Context(), &schema.PackageDescriptor{Name: pkg, Version: v})
 	if err != nil {
 		return nil, fmt.Errorf("could not resolve resource: %w", err)
 	}
@@ -141,7 +151,7 @@ func resolveFunction(c lsp.Client, loader schema.ReferenceLoader, token, version
 		}
 		v = &version
 	}
-	schema, err := loader.LoadPackageReference(pkg, v)
+	schema, err := loader.LoadPackageReferenceV2(c.Context(), &schema.PackageDescriptor{Name: pkg, Version: v})
 	if err != nil {
 		return nil, fmt.Errorf("could not resolve function: %w", err)
 	}
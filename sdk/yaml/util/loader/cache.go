@@ -0,0 +1,256 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+)
+
+// The default maximum size of the on disk schema cache: 1 GiB.
+const DefaultCacheSize int64 = 1 << 30
+
+// DefaultCacheDir returns the directory used to cache schemas on disk.
+//
+// If $XDG_CACHE_HOME is set, the cache is kept in $XDG_CACHE_HOME/pulumi-lsp.
+// Otherwise it is kept in the Pulumi home directory (~/.pulumi/lsp-cache).
+func DefaultCacheDir() (string, error) {
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "pulumi-lsp"), nil
+	}
+	return workspace.GetPulumiPath("lsp-cache")
+}
+
+// diskCache is a schema.ReferenceLoader that persists the schemas fetched from
+// provider plugins on disk, so they don't need to be fetched again when the
+// server restarts.
+//
+// Each entry is keyed by the package name, its version and a checksum of the
+// plugin's path, size and modification time. Updating or reinstalling a plugin
+// produces a new key, so stale schemas are never served.
+// When the cache grows beyond `maxSize` bytes, the least recently used entries
+// are evicted.
+type diskCache struct {
+	host plugin.Host
+	// The loader used when a schema cannot be served from (or stored in) the
+	// cache.
+	fallback schema.ReferenceLoader
+
+	dir     string
+	maxSize int64
+
+	// Guards writing and evicting entries in `dir`.
+	m sync.Mutex
+}
+
+func newDiskCache(host plugin.Host, fallback schema.ReferenceLoader, dir string, maxSize int64) *diskCache {
+	return &diskCache{
+		host:     host,
+		fallback: fallback,
+		dir:      dir,
+		maxSize:  maxSize,
+	}
+}
+
+// deprecated: use LoadPackageV2
+func (c *diskCache) LoadPackage(pkg string, version *semver.Version) (*schema.Package, error) {
+	return c.LoadPackageV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (c *diskCache) LoadPackageV2(ctx context.Context, descriptor *schema.PackageDescriptor) (*schema.Package, error) {
+	ref, err := c.LoadPackageReferenceV2(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Definition()
+}
+
+// deprecated: use LoadPackageReferenceV2
+func (c *diskCache) LoadPackageReference(pkg string, version *semver.Version) (schema.PackageReference, error) {
+	return c.LoadPackageReferenceV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (c *diskCache) LoadPackageReferenceV2(
+	ctx context.Context, descriptor *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	// Parameterized packages are not identified by their plugin, and the
+	// "pulumi" package is built in.
+	if descriptor.Parameterization != nil || descriptor.Name == "pulumi" {
+		return c.fallback.LoadPackageReferenceV2(ctx, descriptor)
+	}
+
+	// If the plugin is not installed, the fallback loader is responsible for
+	// installing it. The schema will be cached on the next load.
+	info, err := c.host.ResolvePlugin(apitype.ResourcePlugin, descriptor.Name, descriptor.Version)
+	if err != nil || info == nil || info.Version == nil {
+		return c.fallback.LoadPackageReferenceV2(ctx, descriptor)
+	}
+
+	path := c.entryPath(descriptor.Name, *info.Version, pluginChecksum(info))
+	if bytes, err := os.ReadFile(path); err == nil {
+		if ref, err := importSchema(bytes, info.Version, c); err == nil {
+			// Record the use, so recently used entries are evicted last.
+			now := time.Now()
+			contract.IgnoreError(os.Chtimes(path, now, now))
+			return ref, nil
+		}
+		// The entry is corrupt, so we discard it.
+		contract.IgnoreError(os.Remove(path))
+	}
+
+	bytes, err := c.fetchSchema(ctx, descriptor.Name, info.Version)
+	if err != nil {
+		return c.fallback.LoadPackageReferenceV2(ctx, descriptor)
+	}
+	ref, err := importSchema(bytes, info.Version, c)
+	if err != nil {
+		return nil, err
+	}
+	// Failing to write the cache only costs us time on the next start.
+	contract.IgnoreError(c.store(path, bytes))
+	return ref, nil
+}
+
+// fetchSchema retrieves the raw schema from the provider plugin.
+func (c *diskCache) fetchSchema(ctx context.Context, pkg string, version *semver.Version) ([]byte, error) {
+	provider, err := c.host.Provider(tokens.Package(pkg), version)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := provider.GetSchema(ctx, plugin.GetSchemaRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(string(resp.Schema), " \t\r\n{}") == "" {
+		return nil, fmt.Errorf("the %s provider returned an empty schema", pkg)
+	}
+	return resp.Schema, nil
+}
+
+// importSchema parses a schema, stamping in `version` if the schema is missing a
+// version (or has an older version). This mirrors schema.NewPluginLoader.
+//
+// `loader` is used to load packages that the schema references.
+func importSchema(bytes []byte, version *semver.Version, loader schema.Loader) (schema.PackageReference, error) {
+	var spec schema.PartialPackageSpec
+	if err := json.Unmarshal(bytes, &spec); err != nil {
+		return nil, err
+	}
+	if version != nil {
+		existing, err := semver.Make(spec.PackageInfoSpec.Version)
+		if spec.PackageInfoSpec.Version == "" || err != nil || existing.LT(*version) {
+			spec.PackageInfoSpec.Version = version.String()
+		}
+	}
+	return schema.ImportPartialSpec(spec, nil, loader)
+}
+
+// The path of the cache entry for a package.
+func (c *diskCache) entryPath(pkg string, version semver.Version, checksum string) string {
+	key := sha256.Sum256([]byte(pkg + "\x00" + version.String() + "\x00" + checksum))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s-%s.json", pkg, version, hex.EncodeToString(key[:8])))
+}
+
+// store atomically writes a cache entry, then evicts old entries as necessary.
+func (c *diskCache) store(path string, bytes []byte) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(bytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		contract.IgnoreError(os.Remove(tmp.Name()))
+		return err
+	}
+	return c.evict(path)
+}
+
+// evict removes the least recently used cache entries until the cache fits in
+// `maxSize`. The entry at `keep` is never evicted. Calling evict requires
+// holding `c.m`.
+func (c *diskCache) evict(keep string) error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var total int64
+	files := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+		files = append(files, entry{filepath.Join(c.dir, e.Name()), info.Size(), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if f.path == keep {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// pluginChecksum identifies the exact plugin binary that a schema came from.
+//
+// Provider binaries can be hundreds of megabytes, so instead of hashing the
+// binary we hash its identifying metadata: the install location, size and
+// modification time. Any reinstall or upgrade of the plugin changes the
+// checksum.
+func pluginChecksum(info *workspace.PluginInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d", info.Name, info.Path, info.Size, info.InstallTime.UnixNano())
+	binary := filepath.Join(info.Path, "pulumi-resource-"+info.Name)
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	if stat, err := os.Stat(binary); err == nil {
+		fmt.Fprintf(h, "\x00%d\x00%d", stat.Size(), stat.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
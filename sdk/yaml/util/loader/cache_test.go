@@ -0,0 +1,103 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "name": "test",
+  "resources": {
+    "test:index:Resource": {
+      "inputProperties": {"value": {"type": "string"}}
+    }
+  }
+}`
+
+// A plugin.Host with a single installed provider. Calling any other method
+// panics.
+type testHost struct {
+	plugin.Host
+
+	version semver.Version
+	fetches int
+}
+
+func (h *testHost) ResolvePlugin(
+	kind apitype.PluginKind, name string, version *semver.Version,
+) (*workspace.PluginInfo, error) {
+	return &workspace.PluginInfo{Name: name, Kind: kind, Version: &h.version, Path: "/plugins/" + name}, nil
+}
+
+func (h *testHost) Provider(pkg tokens.Package, version *semver.Version) (plugin.Provider, error) {
+	return &testProvider{host: h}, nil
+}
+
+type testProvider struct {
+	plugin.UnimplementedProvider
+
+	host *testHost
+}
+
+func (p *testProvider) GetSchema(context.Context, plugin.GetSchemaRequest) (plugin.GetSchemaResponse, error) {
+	p.host.fetches++
+	return plugin.GetSchemaResponse{Schema: []byte(testSchema)}, nil
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	host := &testHost{version: semver.MustParse("1.2.3")}
+	load := func() schema.PackageReference {
+		// A new cache has no in-memory state, just like a restarted server.
+		cache := newDiskCache(host, nil, dir, DefaultCacheSize)
+		ref, err := cache.LoadPackageReferenceV2(context.Background(), &schema.PackageDescriptor{Name: "test"})
+		require.NoError(t, err)
+		return ref
+	}
+
+	ref := load()
+	assert.Equal(t, 1, host.fetches)
+	assert.Equal(t, "1.2.3", ref.Version().String())
+	_, ok, err := ref.Resources().Get("test:index:Resource")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ref = load()
+	assert.Equal(t, 1, host.fetches, "The schema should have been served from disk")
+	assert.Equal(t, "1.2.3", ref.Version().String())
+
+	// A different plugin version is a different cache entry.
+	host.version = semver.MustParse("1.2.4")
+	load()
+	assert.Equal(t, 2, host.fetches)
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	cache := newDiskCache(nil, nil, dir, 10)
+
+	old := filepath.Join(dir, "old.json")
+	require.NoError(t, os.WriteFile(old, []byte("0123456789"), 0o600))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	current := filepath.Join(dir, "current.json")
+	require.NoError(t, cache.store(current, []byte("0123456789")))
+
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, current)
+}
@@ -4,29 +4,54 @@ package loader
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sync"
 
 	"github.com/blang/semver"
 	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+	"go.lsp.dev/protocol"
+
+	"github.com/pulumi/pulumi-lsp/sdk/lsp"
 )
 
 type ReferenceLoader interface {
 	schema.ReferenceLoader
 
 	Loaded() []schema.PackageDescriptor
+
+	// SetSchemaDirectories replaces the directories searched for local schemas.
+	SetSchemaDirectories(dirs []string)
+	// AddProject makes the local schemas of the Pulumi project at `dir`
+	// available. They are found in the project's ProjectSchemaDir.
+	AddProject(dir string)
 }
 
-func New(host plugin.Host) ReferenceLoader {
-	return &refLoader{inner: schema.NewPluginLoader(host)}
+// Create a new ReferenceLoader that loads schemas from provider plugins.
+//
+// Schemas are first searched for as `schema.json` files in `schemaDirs` and in
+// the ProjectSchemaDir of each added project. Schemas fetched from plugins are
+// cached on disk in DefaultCacheDir, so they don't need to be fetched from
+// plugins again when the server restarts.
+func New(host plugin.Host, schemaDirs []string) ReferenceLoader {
+	var inner schema.ReferenceLoader = schema.NewPluginLoader(host)
+	if dir, err := DefaultCacheDir(); err == nil {
+		inner = newDiskCache(host, inner, dir, DefaultCacheSize)
+	}
+	local := newLocalLoader(newMemoLoader(inner), schemaDirs)
+	return &refLoader{inner: local, local: local, failed: map[string]struct{}{}}
 }
 
 type refLoader struct {
 	inner schema.ReferenceLoader
+	local *localLoader
 
 	m      sync.Mutex
 	loaded []schema.PackageDescriptor
+	// Packages whose last load failed, and the user has been told about it.
+	failed map[string]struct{}
 }
 
 func (r *refLoader) Loaded() []schema.PackageDescriptor {
@@ -38,6 +63,14 @@ func (r *refLoader) Loaded() []schema.PackageDescriptor {
 	return out
 }
 
+func (r *refLoader) SetSchemaDirectories(dirs []string) {
+	r.local.SetSchemaDirectories(dirs)
+}
+
+func (r *refLoader) AddProject(dir string) {
+	r.local.AddProject(dir)
+}
+
 // deprecated: use LoadPackageV2
 func (r *refLoader) LoadPackage(pkg string, version *semver.Version) (*schema.Package, error) {
 	p, err := r.inner.LoadPackage(pkg, version)
@@ -49,7 +82,11 @@ func (r *refLoader) LoadPackage(pkg string, version *semver.Version) (*schema.Pa
 }
 
 func (r *refLoader) LoadPackageV2(ctx context.Context, descriptor *schema.PackageDescriptor) (*schema.Package, error) {
-	p, err := r.inner.LoadPackageV2(ctx, descriptor)
+	done := r.beginProgress(ctx, descriptor)
+	p, err := withContext(ctx, func() (*schema.Package, error) {
+		return r.inner.LoadPackageV2(ctx, descriptor)
+	})
+	done(err)
 	if err != nil {
 		return p, err
 	}
@@ -68,7 +105,11 @@ func (r *refLoader) LoadPackageReference(pkg string, version *semver.Version) (s
 }
 
 func (r *refLoader) LoadPackageReferenceV2(ctx context.Context, descriptor *schema.PackageDescriptor) (schema.PackageReference, error) {
-	p, err := r.inner.LoadPackageReferenceV2(ctx, descriptor)
+	done := r.beginProgress(ctx, descriptor)
+	p, err := withContext(ctx, func() (schema.PackageReference, error) {
+		return r.inner.LoadPackageReferenceV2(ctx, descriptor)
+	})
+	done(err)
 	if err != nil {
 		return p, err
 	}
@@ -83,11 +124,115 @@ func (r *refLoader) push(d *schema.PackageDescriptor) {
 	r.m.Lock()
 	defer r.m.Unlock()
 
+	if r.isLoaded(d) {
+		return
+	}
+
+	r.loaded = append(r.loaded, *d)
+}
+
+// isLoaded checks if `d` has already been loaded. Calling isLoaded requires
+// holding `r.m`.
+func (r *refLoader) isLoaded(d *schema.PackageDescriptor) bool {
 	for _, o := range r.loaded {
 		if reflect.DeepEqual(*d, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// beginProgress reports to the client that `d` is being loaded. The returned
+// function must be called with the result of the load.
+//
+// Progress is only reported for packages that have not been loaded before, and
+// only when the load was requested on behalf of a client. Loads that are part of
+// an operation that already reports progress, such as loading every schema of a
+// template, don't report progress of their own. If the load fails, the user is
+// notified once, so they know why information about the package is missing.
+func (r *refLoader) beginProgress(ctx context.Context, d *schema.PackageDescriptor) func(error) {
+	client, ok := lsp.ClientFromContext(ctx)
+	if !ok || d == nil {
+		return func(error) {}
+	}
+	r.m.Lock()
+	loaded := r.isLoaded(d)
+	r.m.Unlock()
+	if loaded {
+		return func(error) {}
+	}
+
+	name := descriptorString(d)
+	progress, reported := lsp.ProgressFromContext(ctx)
+	if !reported {
+		var err error
+		progress, err = client.BeginProgress("Loading schema", fmt.Sprintf("Loading schema %s…", name))
+		contract.IgnoreError(err)
+	}
+	end := func(message string) {
+		if !reported {
+			contract.IgnoreError(progress.End(message))
+		}
+	}
+	return func(err error) {
+		if err == nil {
+			end(fmt.Sprintf("Loaded schema %s", name))
+			r.m.Lock()
+			delete(r.failed, name)
+			r.m.Unlock()
+			return
+		}
+		end(fmt.Sprintf("Failed to load schema %s", name))
+		if ctx.Err() != nil {
+			// The load was canceled, which is not a failure.
 			return
 		}
+		r.m.Lock()
+		_, notified := r.failed[name]
+		r.failed[name] = struct{}{}
+		r.m.Unlock()
+		if !notified {
+			contract.IgnoreError(client.ShowMessage(&protocol.ShowMessageParams{
+				Type: protocol.MessageTypeWarning,
+				Message: fmt.Sprintf("Failed to load schema %s: %s. "+
+					"Completion and hover information for %s will be missing.", name, err, d.Name),
+			}))
+		}
 	}
+}
 
-	r.loaded = append(r.loaded, *d)
+// descriptorString renders a package descriptor as `name@version`, or just
+// `name` if no version is specified.
+func descriptorString(d *schema.PackageDescriptor) string {
+	if d.Version == nil {
+		return d.Name
+	}
+	return fmt.Sprintf("%s@%s", d.Name, d.Version)
+}
+
+// withContext runs `load`, returning early with `ctx.Err()` if `ctx` is canceled
+// before `load` finishes.
+//
+// Loading a schema can block on resolving and installing plugins, which does
+// not observe `ctx`. This lets a canceled request stop waiting on the load.
+func withContext[T any](ctx context.Context, load func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := load()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
 }
@@ -0,0 +1,223 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// The directory, relative to a Pulumi project, searched for local schemas.
+const ProjectSchemaDir = ".pulumi/schemas"
+
+// localLoader is a schema.ReferenceLoader that serves schemas from `schema.json`
+// files on disk. This allows working offline, in air-gapped environments, and
+// with providers that are still under development.
+//
+// In each directory it searches, a package `name` is served from (in order):
+//
+//   - `name-<version>.json`, when a version is requested
+//   - `name.json` or `name/schema.json`
+//   - the highest versioned `name-<version>.json`, when no version is requested
+//
+// Packages not found locally are loaded by `next`.
+type localLoader struct {
+	next schema.ReferenceLoader
+
+	m sync.Mutex
+	// The directories configured by the user. They are searched first.
+	dirs []string
+	// The `.pulumi/schemas` directories of known projects.
+	projects []string
+	// Parsed schemas, keyed by path and requested version. They are reused
+	// until the file changes.
+	entries map[string]localEntry
+}
+
+type localEntry struct {
+	modTime time.Time
+	ref     schema.PackageReference
+}
+
+func newLocalLoader(next schema.ReferenceLoader, dirs []string) *localLoader {
+	l := &localLoader{next: next, entries: map[string]localEntry{}}
+	l.SetSchemaDirectories(dirs)
+	return l
+}
+
+// SetSchemaDirectories replaces the set of user configured directories.
+func (l *localLoader) SetSchemaDirectories(dirs []string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.dirs = make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		l.dirs = append(l.dirs, dir)
+	}
+}
+
+// AddProject makes the schemas in the `.pulumi/schemas` directory of the
+// project at `dir` available.
+func (l *localLoader) AddProject(dir string) {
+	dir = filepath.Join(dir, filepath.FromSlash(ProjectSchemaDir))
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, p := range l.projects {
+		if p == dir {
+			return
+		}
+	}
+	l.projects = append(l.projects, dir)
+}
+
+// deprecated: use LoadPackageV2
+func (l *localLoader) LoadPackage(pkg string, version *semver.Version) (*schema.Package, error) {
+	return l.LoadPackageV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (l *localLoader) LoadPackageV2(ctx context.Context, descriptor *schema.PackageDescriptor) (*schema.Package, error) {
+	ref, err := l.LoadPackageReferenceV2(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Definition()
+}
+
+// deprecated: use LoadPackageReferenceV2
+func (l *localLoader) LoadPackageReference(pkg string, version *semver.Version) (schema.PackageReference, error) {
+	return l.LoadPackageReferenceV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (l *localLoader) LoadPackageReferenceV2(
+	ctx context.Context, descriptor *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	if descriptor.Parameterization == nil {
+		l.m.Lock()
+		dirs := append(append([]string{}, l.dirs...), l.projects...)
+		l.m.Unlock()
+		for _, dir := range dirs {
+			if ref, ok := l.loadFrom(dir, descriptor.Name, descriptor.Version); ok {
+				return ref, nil
+			}
+		}
+	}
+	return l.next.LoadPackageReferenceV2(ctx, descriptor)
+}
+
+// loadFrom attempts to load `pkg` from the schemas in `dir`.
+func (l *localLoader) loadFrom(dir, pkg string, version *semver.Version) (schema.PackageReference, bool) {
+	candidates := []string{}
+	if version != nil {
+		candidates = append(candidates, filepath.Join(dir, pkg+"-"+version.String()+".json"))
+	}
+	candidates = append(candidates,
+		filepath.Join(dir, pkg+".json"),
+		filepath.Join(dir, pkg, "schema.json"))
+	if version == nil {
+		if latest, ok := latestVersioned(dir, pkg); ok {
+			candidates = append(candidates, latest)
+		}
+	}
+	for _, path := range candidates {
+		ref, err := l.loadFile(path, version)
+		if err != nil {
+			continue
+		}
+		if ref.Name() != pkg {
+			continue
+		}
+		if version != nil && ref.Version() != nil && !ref.Version().Equals(*version) {
+			continue
+		}
+		return ref, true
+	}
+	return nil, false
+}
+
+// loadFile parses the schema at `path`, reusing the previous result if the file
+// has not changed.
+func (l *localLoader) loadFile(path string, version *semver.Version) (schema.PackageReference, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := path
+	if version != nil {
+		key += "@" + version.String()
+	}
+	l.m.Lock()
+	entry, ok := l.entries[key]
+	l.m.Unlock()
+	if ok && entry.modTime.Equal(stat.ModTime()) {
+		return entry.ref, nil
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Local schemas describe exactly the version they contain, so we only
+	// stamp in a version when the schema has none.
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(bytes, &info); err != nil {
+		return nil, err
+	}
+	var stamp *semver.Version
+	if info.Version == "" {
+		stamp = version
+	}
+	ref, err := importSchema(bytes, stamp, l)
+	if err != nil {
+		return nil, err
+	}
+	l.m.Lock()
+	l.entries[key] = localEntry{modTime: stat.ModTime(), ref: ref}
+	l.m.Unlock()
+	return ref, nil
+}
+
+// latestVersioned finds the `pkg-<version>.json` file in `dir` with the highest
+// version.
+func latestVersioned(dir, pkg string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	type versioned struct {
+		path    string
+		version semver.Version
+	}
+	var found []versioned
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, pkg+"-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		v, err := semver.ParseTolerant(strings.TrimSuffix(strings.TrimPrefix(name, pkg+"-"), ".json"))
+		if err != nil {
+			continue
+		}
+		found = append(found, versioned{filepath.Join(dir, name), v})
+	}
+	if len(found) == 0 {
+		return "", false
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].version.GT(found[j].version) })
+	return found[0].path, true
+}
@@ -0,0 +1,62 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSchema(t *testing.T, path, version string) {
+	s := testSchema
+	if version != "" {
+		s = strings.Replace(s, `"name": "test",`, `"name": "test", "version": "`+version+`",`, 1)
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, []byte(s), 0o600))
+}
+
+func TestLocalLoader(t *testing.T) {
+	configured, project := t.TempDir(), t.TempDir()
+	writeSchema(t, filepath.Join(configured, "test-1.0.0.json"), "1.0.0")
+	writeSchema(t, filepath.Join(configured, "test-2.0.0.json"), "2.0.0")
+	writeSchema(t, filepath.Join(project, ProjectSchemaDir, "test", "schema.json"), "")
+
+	// Packages not found locally are loaded from plugins.
+	host := &testHost{version: semver.MustParse("3.0.0")}
+	l := newLocalLoader(newDiskCache(host, nil, t.TempDir(), DefaultCacheSize), []string{configured})
+	l.AddProject(project)
+
+	load := func(version string) schema.PackageReference {
+		d := &schema.PackageDescriptor{Name: "test"}
+		if version != "" {
+			v := semver.MustParse(version)
+			d.Version = &v
+		}
+		ref, err := l.LoadPackageReferenceV2(context.Background(), d)
+		require.NoError(t, err)
+		return ref
+	}
+
+	assert.Equal(t, "1.0.0", load("1.0.0").Version().String())
+	assert.Equal(t, "2.0.0", load("").Version().String(), "The newest version should be used")
+	// The project's unversioned schema serves any version.
+	assert.Equal(t, "1.5.0", load("1.5.0").Version().String())
+	assert.Equal(t, 0, host.fetches)
+
+	l.SetSchemaDirectories(nil)
+	assert.Nil(t, load("").Version(), "The project schema has no version")
+	assert.Equal(t, 0, host.fetches)
+
+	l = newLocalLoader(newDiskCache(host, nil, t.TempDir(), DefaultCacheSize), []string{configured})
+	assert.Equal(t, "3.0.0", load("3.0.0").Version().String())
+	assert.Equal(t, 1, host.fetches)
+}
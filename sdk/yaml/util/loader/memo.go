@@ -0,0 +1,98 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/blang/semver"
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// memoLoader is an in-memory cache of package references.
+//
+// Unlike schema.NewCachedLoader, which holds a single lock while loading, loads
+// of different packages proceed in parallel. Concurrent loads of the same
+// package share a single call to `inner`. Failed loads are not cached, so they
+// are retried on the next request. A load that fails because the request that
+// started it was canceled or timed out is retried by the requests waiting on it.
+type memoLoader struct {
+	inner schema.ReferenceLoader
+
+	m       sync.Mutex
+	entries map[string]*memoEntry
+}
+
+type memoEntry struct {
+	// Closed when the load has finished.
+	done chan struct{}
+	ref  schema.PackageReference
+	err  error
+	// Set when the load failed because the request that started it was
+	// canceled or timed out. The error belongs to that request alone.
+	aborted bool
+}
+
+func newMemoLoader(inner schema.ReferenceLoader) *memoLoader {
+	return &memoLoader{inner: inner, entries: map[string]*memoEntry{}}
+}
+
+// deprecated: use LoadPackageV2
+func (l *memoLoader) LoadPackage(pkg string, version *semver.Version) (*schema.Package, error) {
+	return l.LoadPackageV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (l *memoLoader) LoadPackageV2(ctx context.Context, descriptor *schema.PackageDescriptor) (*schema.Package, error) {
+	ref, err := l.LoadPackageReferenceV2(ctx, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Definition()
+}
+
+// deprecated: use LoadPackageReferenceV2
+func (l *memoLoader) LoadPackageReference(pkg string, version *semver.Version) (schema.PackageReference, error) {
+	return l.LoadPackageReferenceV2(context.TODO(), &schema.PackageDescriptor{Name: pkg, Version: version})
+}
+
+func (l *memoLoader) LoadPackageReferenceV2(
+	ctx context.Context, descriptor *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	key := descriptorKey(descriptor)
+	l.m.Lock()
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &memoEntry{done: make(chan struct{})}
+		l.entries[key] = entry
+	}
+	l.m.Unlock()
+
+	if ok {
+		<-entry.done
+		if entry.aborted && ctx.Err() == nil {
+			// The request that started the load was canceled or timed out,
+			// but we were not. Retry the load on our own behalf.
+			return l.LoadPackageReferenceV2(ctx, descriptor)
+		}
+		return entry.ref, entry.err
+	}
+
+	entry.ref, entry.err = l.inner.LoadPackageReferenceV2(ctx, descriptor)
+	entry.aborted = entry.err != nil && ctx.Err() != nil
+	if entry.err != nil {
+		l.m.Lock()
+		delete(l.entries, key)
+		l.m.Unlock()
+	}
+	close(entry.done)
+	return entry.ref, entry.err
+}
+
+// descriptorKey identifies the package a descriptor refers to.
+func descriptorKey(d *schema.PackageDescriptor) string {
+	if p := d.Parameterization; p != nil {
+		return descriptorString(d) + "\x00" + p.Name + "@" + p.Version.String()
+	}
+	return descriptorString(d)
+}
@@ -0,0 +1,157 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A schema.ReferenceLoader that counts how many loads are in flight.
+type slowLoader struct {
+	schema.ReferenceLoader
+
+	loads, active, maxActive atomic.Int32
+}
+
+func (l *slowLoader) LoadPackageReferenceV2(
+	ctx context.Context, d *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	l.loads.Add(1)
+	active := l.active.Add(1)
+	defer l.active.Add(-1)
+	for {
+		max := l.maxActive.Load()
+		if active <= max || l.maxActive.CompareAndSwap(max, active) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return importSchema([]byte(`{"name": "`+d.Name+`"}`), nil, l)
+}
+
+func TestMemoLoader(t *testing.T) {
+	inner := &slowLoader{}
+	memo := newMemoLoader(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ref, err := memo.LoadPackageReferenceV2(context.Background(), &schema.PackageDescriptor{Name: "test"})
+			require.NoError(t, err)
+			assert.Equal(t, "test", ref.Name())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), inner.loads.Load(), "Concurrent loads should be shared")
+}
+
+// A schema.ReferenceLoader whose first load blocks until its request is done.
+type abortedLoader struct {
+	schema.ReferenceLoader
+
+	started chan struct{}
+	loads   atomic.Int32
+}
+
+func (l *abortedLoader) LoadPackageReferenceV2(
+	ctx context.Context, d *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	if l.loads.Add(1) == 1 {
+		close(l.started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return importSchema([]byte(`{"name": "`+d.Name+`"}`), nil, l)
+}
+
+func TestMemoLoaderAborted(t *testing.T) {
+	for _, abort := range []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+	}{
+		{"canceled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() { time.Sleep(10 * time.Millisecond); cancel() }()
+			return ctx, cancel
+		}},
+		{"timed out", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}},
+	} {
+		abort := abort
+		t.Run(abort.name, func(t *testing.T) {
+			inner := &abortedLoader{started: make(chan struct{})}
+			memo := newMemoLoader(inner)
+			descriptor := &schema.PackageDescriptor{Name: "test"}
+
+			ctx, cancel := abort.ctx()
+			defer cancel()
+			done := make(chan error)
+			go func() {
+				_, err := memo.LoadPackageReferenceV2(ctx, descriptor)
+				done <- err
+			}()
+			<-inner.started
+
+			// The error of the aborted request is not shared with its waiters.
+			ref, err := memo.LoadPackageReferenceV2(context.Background(), descriptor)
+			require.NoError(t, err)
+			assert.Equal(t, "test", ref.Name())
+			assert.ErrorIs(t, <-done, ctx.Err())
+			assert.Equal(t, int32(2), inner.loads.Load())
+		})
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	inner := &slowLoader{}
+	memo := newMemoLoader(inner)
+	var packages []schema.PackageDescriptor
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		packages = append(packages, schema.PackageDescriptor{Name: name})
+	}
+	Prefetch(context.Background(), memo, packages, nil)
+
+	assert.Equal(t, int32(len(packages)), inner.loads.Load())
+	assert.Greater(t, inner.maxActive.Load(), int32(1), "Packages should load in parallel")
+	assert.LessOrEqual(t, inner.maxActive.Load(), int32(PrefetchParallelism))
+
+	// Prefetched packages are served from memory.
+	_, err := memo.LoadPackageReferenceV2(context.Background(), &schema.PackageDescriptor{Name: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(len(packages)), inner.loads.Load())
+}
+
+// A schema.ReferenceLoader that fails to load every package.
+type failingLoader struct {
+	schema.ReferenceLoader
+}
+
+func (failingLoader) LoadPackageReferenceV2(
+	ctx context.Context, d *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	return nil, errors.New("no plugin for " + d.Name)
+}
+
+func TestPrefetchFailures(t *testing.T) {
+	packages := []schema.PackageDescriptor{{Name: "a"}, {Name: "b"}}
+	var m sync.Mutex
+	failed := map[string]string{}
+	Prefetch(context.Background(), failingLoader{}, packages, func(d *schema.PackageDescriptor, err error) {
+		m.Lock()
+		defer m.Unlock()
+		failed[d.Name] = err.Error()
+	})
+	assert.Equal(t, map[string]string{"a": "no plugin for a", "b": "no plugin for b"}, failed)
+}
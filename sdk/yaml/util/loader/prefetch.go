@@ -0,0 +1,52 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+package loader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+)
+
+// The number of schemas Prefetch loads at once. Each load may start a provider
+// plugin, so we don't want to start too many at a time.
+const PrefetchParallelism = 4
+
+// Prefetch loads `packages` with `loader`, so that later loads are served from
+// memory. At most PrefetchParallelism packages are loaded at once.
+//
+// Prefetch blocks until every package has been loaded or `ctx` is canceled.
+// Failures are passed to `failed`, if it is not nil. They are not reported to
+// the user, since the user never asked for the packages: they are reported when
+// the package is needed.
+func Prefetch(
+	ctx context.Context, loader schema.ReferenceLoader, packages []schema.PackageDescriptor,
+	failed func(*schema.PackageDescriptor, error),
+) {
+	work := make(chan *schema.PackageDescriptor)
+	var wg sync.WaitGroup
+	for i := 0; i < PrefetchParallelism && i < len(packages); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for desc := range work {
+				_, err := loader.LoadPackageReferenceV2(ctx, desc)
+				if err != nil && failed != nil {
+					failed(desc, err)
+				}
+			}
+		}()
+	}
+	for i := range packages {
+		select {
+		case work <- &packages[i]:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,109 @@
+// Copyright 2022, Pulumi Corporation.  All rights reserved.
+
+// Package testutil holds the schema fixtures shared by the tests of the YAML
+// server.
+package testutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pulumi/pulumi/pkg/v3/codegen/schema"
+
+	"github.com/pulumi/pulumi-lsp/sdk/yaml/util/loader"
+)
+
+// SpecLoader is a loader.ReferenceLoader serving packages from their specs.
+type SpecLoader struct {
+	loader.ReferenceLoader
+
+	Specs map[string]schema.PackageSpec
+}
+
+// Loader serves `packages`, keyed by their names.
+func Loader(packages ...schema.PackageSpec) SpecLoader {
+	specs := map[string]schema.PackageSpec{}
+	for _, p := range packages {
+		specs[p.Name] = p
+	}
+	return SpecLoader{Specs: specs}
+}
+
+func (l SpecLoader) LoadPackageReferenceV2(
+	ctx context.Context, d *schema.PackageDescriptor,
+) (schema.PackageReference, error) {
+	spec, ok := l.Specs[d.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown package %q", d.Name)
+	}
+	pkg, err := schema.ImportSpec(spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Reference(), nil
+}
+
+// Package returns the spec of the `test` package. Each call returns a new spec,
+// so a test can extend it without affecting other tests.
+func Package() schema.PackageSpec {
+	str := schema.TypeSpec{Type: "string"}
+	return schema.PackageSpec{
+		Name: "test",
+		Resources: map[string]schema.ResourceSpec{
+			"test:index:Resource": {
+				InputProperties: map[string]schema.PropertySpec{
+					"name": {TypeSpec: str},
+					"tags": {TypeSpec: schema.TypeSpec{Type: "object", AdditionalProperties: &str}},
+					"rules": {TypeSpec: schema.TypeSpec{Type: "array",
+						Items: &schema.TypeSpec{Ref: "#/types/test:index:Rule"}}},
+				},
+				ObjectTypeSpec: schema.ObjectTypeSpec{
+					Properties: map[string]schema.PropertySpec{
+						"arn": {TypeSpec: str},
+					},
+				},
+			},
+			"test:index:Database": {
+				InputProperties: map[string]schema.PropertySpec{
+					"name":     {TypeSpec: str},
+					"password": {TypeSpec: str, Secret: true},
+					"users": {TypeSpec: schema.TypeSpec{Type: "array",
+						Items: &schema.TypeSpec{Ref: "#/types/test:index:User"}}},
+				},
+				ObjectTypeSpec: schema.ObjectTypeSpec{
+					Properties: map[string]schema.PropertySpec{
+						"endpoint":         {TypeSpec: str},
+						"connectionString": {TypeSpec: str, Secret: true},
+					},
+				},
+			},
+		},
+		Functions: map[string]schema.FunctionSpec{
+			"test:index:getThing": {
+				Outputs: &schema.ObjectTypeSpec{
+					Properties: map[string]schema.PropertySpec{
+						"id": {TypeSpec: str, Description: "The ID of the thing."},
+						"rule": {TypeSpec: schema.TypeSpec{Ref: "#/types/test:index:Rule"},
+							Description: "The rule of the thing."},
+					},
+				},
+			},
+		},
+		Types: map[string]schema.ComplexTypeSpec{
+			"test:index:Rule": {ObjectTypeSpec: schema.ObjectTypeSpec{
+				Type: "object",
+				Properties: map[string]schema.PropertySpec{
+					"port": {TypeSpec: schema.TypeSpec{Type: "integer"}, Description: "The port to use."},
+					"host": {TypeSpec: str},
+				},
+			}},
+			"test:index:User": {ObjectTypeSpec: schema.ObjectTypeSpec{
+				Type: "object",
+				Properties: map[string]schema.PropertySpec{
+					"name":     {TypeSpec: str},
+					"password": {TypeSpec: str, Secret: true},
+				},
+			}},
+		},
+	}
+}
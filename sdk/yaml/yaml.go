@@ -4,11 +4,17 @@
 package yaml
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sync"
 
+	"github.com/blang/semver"
 	"go.lsp.dev/protocol"
 
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/plugin"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
 
 	"github.com/pulumi/pulumi-lsp/sdk/lsp"
 	"github.com/pulumi/pulumi-lsp/sdk/version"
@@ -19,20 +25,40 @@ import (
 type server struct {
 	docs    map[protocol.DocumentURI]*document
 	schemas loader.ReferenceLoader
+	// The schema directories passed on the command line.
+	schemaDirs []string
+	// The installed versions of each resource plugin.
+	plugins *pluginCache
+	// The tab size configured by the client, or 0 if none was configured.
+	tabSize int
+}
+
+// Options configures the Pulumi YAML server.
+type Options struct {
+	// Directories searched for local `schema.json` files before loading
+	// schemas from provider plugins.
+	SchemaDirectories []string
 }
 
 // Create the set of methods necessary to implement a LSP server for Pulumi YAML.
-func Methods(host plugin.Host) *lsp.Methods {
+func Methods(host plugin.Host, opts Options) *lsp.Methods {
 	server := &server{
-		docs:    map[protocol.DocumentURI]*document{},
-		schemas: loader.New(host),
+		docs:       map[protocol.DocumentURI]*document{},
+		schemas:    loader.New(host, opts.SchemaDirectories),
+		schemaDirs: opts.SchemaDirectories,
+
+		plugins: newPluginCache(installedPluginVersions),
 	}
 	return lsp.Methods{
-		DidOpenFunc:    server.didOpen,
-		DidCloseFunc:   server.didClose,
-		DidChangeFunc:  server.didChange,
-		HoverFunc:      server.hover,
-		CompletionFunc: server.completion,
+		DidOpenFunc:                server.didOpen,
+		DidCloseFunc:               server.didClose,
+		DidChangeFunc:              server.didChange,
+		DidChangeConfigurationFunc: server.didChangeConfiguration,
+		HoverFunc:                  server.hover,
+		CompletionFunc:             server.completion,
+		DefinitionFunc:             server.definition,
+		CodeActionFunc:             server.codeAction,
+		DocumentLinkFunc:           server.documentLink,
 	}.DefaultInitializer("pulumi-lsp", version.Version)
 }
 
@@ -57,24 +83,114 @@ type document struct {
 
 	// A handle to the currently executing analysis pipeline.
 	analysis *documentAnalysisPipeline
+
+	// The analysis of a stack configuration file. Stack files are analyzed
+	// instead of running the analysis pipeline.
+	stack *stackAnalysis
+
+	// The key tree of the text, built on first use after each change.
+	tree struct {
+		sync.Mutex
+		built bool
+		tree  *yamlTree
+	}
+}
+
+func (d *document) isStack() bool {
+	return isStackFile(d.text.URI().Filename())
 }
 
 // Starts an analysis process for the document.
 func (d *document) process(c lsp.Client) {
+	if d.isStack() {
+		if d.stack != nil {
+			d.stack.stop()
+		}
+		a := d.server.analyzeStack(d.text)
+		d.stack = a
+		contract.IgnoreError(a.sendDiags(c, d.text.URI()))
+
+		// Provider schemas may take a while to load, so provider keys are
+		// checked in the background.
+		var ctx context.Context
+		ctx, a.cancel = context.WithCancel(c.Context())
+		go func(uri protocol.DocumentURI) {
+			if a.loadProviders(ctx, d.server.schemas) {
+				contract.IgnoreError(a.sendDiags(c, uri))
+			}
+		}(d.text.URI())
+		return
+	}
 	if d.analysis != nil {
 		d.analysis.cancel()
 	}
-	d.analysis = NewDocumentAnalysisPipeline(c, d.text, d.server.schemas)
+	var installed func() (map[string][]semver.Version, error)
+	if d.server.plugins != nil {
+		installed = d.server.plugins.get
+	}
+	d.analysis = NewDocumentAnalysisPipeline(c, d.text, d.server.schemas, installed)
+
+	// Stack files are checked against their project, so they need to be
+	// checked again when the project changes.
+	dir := filepath.Dir(d.text.URI().Filename())
+	for _, other := range d.server.docs {
+		if other.isStack() && filepath.Dir(other.text.URI().Filename()) == dir {
+			other.process(c)
+		}
+	}
 }
 
 func (s *server) didOpen(client lsp.Client, params *protocol.DidOpenTextDocumentParams) error {
 	fileName := params.TextDocument.URI.Filename()
 	text := params.TextDocument.Text
 	err := client.LogDebugf("Opened file %s:\n---\n%s---", fileName, text)
-	s.setDocument(lsp.NewDocument(params.TextDocument)).process(client)
+	// Pulumi YAML templates live at the root of their project.
+	s.schemas.AddProject(filepath.Dir(fileName))
+	doc := s.setDocument(lsp.NewDocument(params.TextDocument))
+	doc.process(client)
+	if !doc.isStack() {
+		// The document may change while we prewarm, so we pass a snapshot.
+		go s.prewarm(client, fileName, doc.text.String())
+	}
 	return err
 }
 
+// The settings the client can send in the "pulumi-lsp" configuration section.
+type settings struct {
+	// Directories searched for local `schema.json` files, in addition to those
+	// passed on the command line.
+	SchemaDirectories []string `json:"schemaDirectories"`
+	// The client's formatting options. Completions indent nested blocks by
+	// `tabSize` spaces when the document's own indentation can't be detected.
+	FormattingOptions *protocol.FormattingOptions `json:"formattingOptions"`
+}
+
+func (s *server) didChangeConfiguration(client lsp.Client, params *protocol.DidChangeConfigurationParams) error {
+	var config struct {
+		Settings settings `json:"pulumi-lsp"`
+	}
+	bytes, err := json.Marshal(params.Settings)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return fmt.Errorf("invalid pulumi-lsp settings: %w", err)
+	}
+	dirs := append(append([]string{}, s.schemaDirs...), config.Settings.SchemaDirectories...)
+	s.schemas.SetSchemaDirectories(dirs)
+	client.LogDebugf("Searching for local schemas in %v", dirs)
+	s.tabSize = 0
+	if opts := config.Settings.FormattingOptions; opts != nil {
+		s.tabSize = int(opts.TabSize)
+	}
+
+	// Reanalyze open documents, since their schemas may have changed.
+	for _, doc := range s.docs {
+		doc.process(client)
+	}
+	return nil
+}
+
 func (s *server) didClose(client lsp.Client, params *protocol.DidCloseTextDocumentParams) error {
 	uri := params.TextDocument.URI
 	client.LogDebugf("Closing file %s", uri.Filename())
@@ -97,6 +213,7 @@ func (s *server) didChange(client lsp.Client, params *protocol.DidChangeTextDocu
 		// the document.
 		return fmt.Errorf("document might be unknown: %w", err)
 	}
+	doc.invalidateKeyTree()
 	doc.process(client)
 	return nil
 }
@@ -109,10 +226,10 @@ func (s *server) hover(client lsp.Client, params *protocol.HoverParams) (*protoc
 		return nil, fmt.Errorf("could not find an opened document %s", uri.Filename())
 	}
 	if doc.analysis == nil {
-		// Do nothing. We can try again later.
+		// Do nothing. We can try again later. Stack files don't support hover.
 		return nil, nil
 	}
-	typ, err := doc.objectAtPoint(pos)
+	typ, err := doc.objectAtPoint(client.Context(), pos)
 	if err != nil {
 		client.LogErrorf("%s", err.Error())
 		return nil, nil
@@ -136,6 +253,9 @@ func (s *server) completion(client lsp.Client, params *protocol.CompletionParams
 	if !ok {
 		return nil, fmt.Errorf("could not find an opened document %s", uri.Filename())
 	}
+	if doc.isStack() {
+		return s.completeStack(client, doc, params)
+	}
 
 	// Complete for `type: ...` or `Function: ...`.
 	typeFuncCompletion, err := s.completeType(client, doc, params)
@@ -143,13 +263,37 @@ func (s *server) completion(client lsp.Client, params *protocol.CompletionParams
 		return typeFuncCompletion, err
 	}
 
+	// Complete for the return value of invokes.
+	returnCompletion, err := s.completeInvokeReturn(client, doc, params)
+	if err != nil || returnCompletion != nil {
+		return returnCompletion, err
+	}
+
+	// Complete for the versions of installed plugins.
+	versionCompletion, err := s.completeVersion(client, doc, params)
+	if err != nil || versionCompletion != nil {
+		return versionCompletion, err
+	}
+
+	// Complete for paths given to file builtins.
+	pathCompletion, err := s.completeFilePath(client, doc, params)
+	if err != nil || pathCompletion != nil {
+		return pathCompletion, err
+	}
+
+	// Complete for property paths in resource options.
+	pathCompletion, err = s.completePropertyPath(client, doc, params)
+	if err != nil || pathCompletion != nil {
+		return pathCompletion, err
+	}
+
 	// Complete for new keys in the YAML
 	keyCompletion, err := s.completeKey(client, doc, params)
 	if err != nil || keyCompletion != nil {
 		return keyCompletion, err
 	}
 
-	o, err := doc.objectAtPoint(params.Position)
+	o, err := doc.objectAtPoint(client.Context(), params.Position)
 	if err != nil {
 		client.LogErrorf("%s", err.Error())
 		return nil, nil
@@ -162,3 +306,15 @@ func (s *server) completion(client lsp.Client, params *protocol.CompletionParams
 	client.LogWarningf("No handler responded to completion call")
 	return nil, nil
 }
+
+func (s *server) definition(client lsp.Client, params *protocol.DefinitionParams) ([]protocol.Location, error) {
+	uri := params.TextDocument.URI
+	doc, ok := s.getDocument(uri)
+	if !ok {
+		return nil, fmt.Errorf("could not find an opened document %s", uri.Filename())
+	}
+	if doc.stack != nil {
+		return doc.stack.definition(params.Position), nil
+	}
+	return nil, nil
+}